@@ -0,0 +1,349 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"golang.org/x/crypto/hkdf"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"time"
+)
+
+// Config holds every setting of the service. Load fills it from, in increasing priority, the defaults, an optional
+// YAML file, environment variables and command-line flags.
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Database  Database  `yaml:"database"`
+	Auth      Auth      `yaml:"auth"`
+	Messaging Messaging `yaml:"messaging"`
+	Services  Services  `yaml:"services"`
+	Tracing   Tracing   `yaml:"tracing"`
+	// AccountTypesLimit maps every supported account type to its overdraft limit.
+	AccountTypesLimit map[string]int `yaml:"accountTypesLimit"`
+}
+
+type Server struct {
+	Addr            string        `yaml:"addr"`
+	GinMode         string        `yaml:"ginMode"`
+	ReadTimeout     time.Duration `yaml:"readTimeout"`
+	WriteTimeout    time.Duration `yaml:"writeTimeout"`
+	IdleTimeout     time.Duration `yaml:"idleTimeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	// ShutdownDelay is how long the readiness check fails before the server stops accepting connections.
+	ShutdownDelay time.Duration `yaml:"shutdownDelay"`
+	// ReadyCheckTransactionAPI adds the transaction API to the readiness check.
+	ReadyCheckTransactionAPI bool `yaml:"readyCheckTransactionAPI"`
+}
+
+type Database struct {
+	// Backend is 'dynamodb', 'postgres' or 'memory'.
+	Backend string `yaml:"backend"`
+	// Timeout bounds every database call.
+	Timeout      time.Duration `yaml:"timeout"`
+	DynamoDB     DynamoDB      `yaml:"dynamodb"`
+	PostgresURL  string        `yaml:"postgresURL"`
+	MigrateMoney bool          `yaml:"migrateMoney"`
+}
+
+type DynamoDB struct {
+	Region string `yaml:"region"`
+	// Endpoint overrides the AWS endpoint, e.g. for DynamoDB Local. Empty uses AWS.
+	Endpoint        string `yaml:"endpoint"`
+	AccessKeyID     string `yaml:"accessKeyID"`
+	SecretAccessKey string `yaml:"secretAccessKey"`
+}
+
+type Auth struct {
+	JWTSecret string `yaml:"jwtSecret"`
+	// HMACFallback accepts HMAC tokens signed with JWTSecret next to the JWKS keys.
+	HMACFallback bool `yaml:"hmacFallback"`
+	// JWKSURL is the http(s) URL or file path of the JSON Web Key Set for RS256 and ES256 tokens. Empty disables them.
+	JWKSURL string `yaml:"jwksURL"`
+	// JWKSRefreshInterval is how often the key set is loaded again.
+	JWKSRefreshInterval time.Duration `yaml:"jwksRefreshInterval"`
+	// Issuer and Audience must match the iss and aud claims of every token.
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// ClockSkew is the leeway allowed when checking exp, nbf and iat.
+	ClockSkew time.Duration `yaml:"clockSkew"`
+	// CursorSecret signs pagination cursors. It defaults to a key derived from JWTSecret.
+	CursorSecret string `yaml:"cursorSecret"`
+	// AuditSecret keys the hashes of the audit log. It defaults to a key derived from JWTSecret.
+	AuditSecret string `yaml:"auditSecret"`
+}
+
+type Messaging struct {
+	AMQPURL string `yaml:"amqpURL"`
+	// LogQueue is the queue the amqp sink publishes log records to.
+	LogQueue       string `yaml:"logQueue"`
+	EventsExchange string `yaml:"eventsExchange"`
+	SpoolDir       string `yaml:"spoolDir"`
+	// LogSinks lists where log records go: 'amqp', 'file', 'stdout' and 'nats'. Empty means 'amqp' when AMQPURL is
+	// set and 'stdout' otherwise.
+	LogSinks []string `yaml:"logSinks"`
+	// LogFormat is 'json' or 'text'.
+	LogFormat string  `yaml:"logFormat"`
+	LogFile   LogFile `yaml:"logFile"`
+	NATS      NATS    `yaml:"nats"`
+}
+
+type LogFile struct {
+	Path string `yaml:"path"`
+	// MaxSize in megabytes.
+	MaxSize    int `yaml:"maxSize"`
+	MaxBackups int `yaml:"maxBackups"`
+}
+
+type NATS struct {
+	URL     string `yaml:"url"`
+	Subject string `yaml:"subject"`
+}
+
+type Services struct {
+	TransactionAPI string        `yaml:"transactionAPI"`
+	AccountStat    string        `yaml:"accountStat"`
+	Timeout        time.Duration `yaml:"timeout"`
+}
+
+type Tracing struct {
+	// Exporter is 'none', 'otlp' or 'stdout'.
+	Exporter string `yaml:"exporter"`
+}
+
+// Default returns the settings used for everything that is not configured.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:            ":8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 10 * time.Second,
+		},
+		Auth: Auth{
+			HMACFallback:        true,
+			JWKSRefreshInterval: 5 * time.Minute,
+			ClockSkew:           time.Minute,
+		},
+		Database: Database{
+			Backend: "dynamodb",
+			Timeout: 10 * time.Second,
+			DynamoDB: DynamoDB{
+				Endpoint: "http://dynamodb:8000",
+			},
+		},
+		Messaging: Messaging{
+			EventsExchange: "account.events",
+			SpoolDir:       "spool",
+			LogFormat:      "json",
+			LogFile: LogFile{
+				Path:       "logs/requests.log",
+				MaxSize:    100,
+				MaxBackups: 5,
+			},
+			NATS: NATS{
+				Subject: "account.logs",
+			},
+		},
+		Services: Services{
+			TransactionAPI: "http://transaction-api:8085",
+			AccountStat:    "http://account-stat:8090",
+			Timeout:        10 * time.Second,
+		},
+		Tracing: Tracing{
+			Exporter: "none",
+		},
+		AccountTypesLimit: map[string]int{
+			"checking": 50,
+			"saving":   10,
+		},
+	}
+}
+
+// Load reads the configuration. The YAML file is given by the -config flag or CONFIG_FILE; without either, only
+// environment variables and flags are read. The returned configuration has been validated.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	fs := flag.NewFlagSet("account-service", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	flags := make(map[string]string)
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
+		}
+		name := s.flag
+		fs.Func(name, s.usage+" ($"+s.env+")", func(value string) error {
+			flags[name] = value
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	var errs []error
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok && value != "" {
+			if err := s.value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", s.env, err))
+			}
+		}
+		if value, ok := flags[s.flag]; ok {
+			if err := s.value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid -%s: %w", s.flag, err))
+			}
+		}
+	}
+
+	if cfg.Auth.CursorSecret == "" && cfg.Auth.JWTSecret != "" {
+		cfg.Auth.CursorSecret = deriveSecret(cfg.Auth.JWTSecret, "cursor")
+	}
+	if cfg.Auth.AuditSecret == "" && cfg.Auth.JWTSecret != "" {
+		cfg.Auth.AuditSecret = deriveSecret(cfg.Auth.JWTSecret, "audit")
+	}
+	if err := errors.Join(append(errs, cfg.Validate())...); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// deriveSecret derives a separate key for purpose from secret with HKDF-SHA256, so a leaked derived key does not
+// reveal secret and keys for different purposes are independent.
+func deriveSecret(secret, purpose string) string {
+	key := make([]byte, sha256.Size)
+	reader := hkdf.New(sha256.New, []byte(secret), nil, []byte("account-service "+purpose))
+	if _, err := io.ReadFull(reader, key); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(key)
+}
+
+func (receiver *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// yaml.v3 merges into an existing map, so the default account types would survive a file that lists its own.
+	limits := receiver.AccountTypesLimit
+	receiver.AccountTypesLimit = nil
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(receiver); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	if receiver.AccountTypesLimit == nil {
+		receiver.AccountTypesLimit = limits
+	}
+	return nil
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate reports every invalid setting at once.
+func (receiver Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(receiver.Server.Addr != "", "SERVER_ADDR must not be empty")
+	check(oneOf(receiver.Server.GinMode, "", "debug", "release", "test"),
+		"GIN_MODE must be 'debug', 'release' or 'test', got %q", receiver.Server.GinMode)
+	check(receiver.Server.ReadTimeout > 0 && receiver.Server.WriteTimeout > 0 && receiver.Server.IdleTimeout > 0 &&
+		receiver.Server.ShutdownTimeout > 0, "server timeouts must be positive")
+	check(receiver.Server.ShutdownDelay >= 0, "SHUTDOWN_DELAY must not be negative")
+
+	check(oneOf(receiver.Database.Backend, "dynamodb", "postgres", "memory"),
+		"DB_BACKEND must be 'dynamodb', 'postgres' or 'memory', got %q", receiver.Database.Backend)
+	check(receiver.Database.Timeout > 0, "DB_TIMEOUT must be positive")
+	if receiver.Database.Backend == "dynamodb" {
+		check(receiver.Database.DynamoDB.Region != "", "REGION is required with DB_BACKEND=dynamodb")
+	}
+	if receiver.Database.Backend == "postgres" {
+		check(receiver.Database.PostgresURL != "", "DATABASE_URL is required with DB_BACKEND=postgres")
+	}
+
+	check(receiver.Auth.HMACFallback || receiver.Auth.JWKSURL != "",
+		"JWKS_URL is required with JWT_HMAC_FALLBACK=false, or no token would be accepted")
+	if receiver.Auth.HMACFallback {
+		check(receiver.Auth.JWTSecret != "", "JWT_SECRET is required unless JWT_HMAC_FALLBACK=false")
+	}
+	check(receiver.Auth.Issuer != "", "JWT_ISSUER is required")
+	check(receiver.Auth.Audience != "", "JWT_AUDIENCE is required")
+	check(receiver.Auth.ClockSkew >= 0, "JWT_CLOCK_SKEW must not be negative")
+	check(receiver.Auth.CursorSecret != "", "CURSOR_SECRET is required when JWT_SECRET is not set")
+	check(receiver.Auth.AuditSecret != "", "AUDIT_SECRET is required when JWT_SECRET is not set")
+	if receiver.Auth.JWKSURL != "" {
+		check(receiver.Auth.JWKSRefreshInterval > 0, "JWKS_REFRESH_INTERVAL must be positive")
+	}
+
+	for _, sink := range receiver.Messaging.LogSinks {
+		check(oneOf(sink, "amqp", "file", "stdout", "nats"),
+			"LOG_SINKS entries must be 'amqp', 'file', 'stdout' or 'nats', got %q", sink)
+		if sink == "amqp" {
+			check(receiver.Messaging.AMQPURL != "", "AMQP_URL is required for the amqp log sink")
+		}
+		if sink == "nats" {
+			check(receiver.Messaging.NATS.URL != "", "NATS_URL is required for the nats log sink")
+		}
+		if sink == "file" {
+			check(receiver.Messaging.LogFile.Path != "", "LOG_FILE is required for the file log sink")
+		}
+	}
+	check(oneOf(receiver.Messaging.LogFormat, "json", "text"),
+		"LOG_FORMAT must be 'json' or 'text', got %q", receiver.Messaging.LogFormat)
+	check(receiver.Messaging.LogFile.MaxSize > 0 && receiver.Messaging.LogFile.MaxBackups > 0,
+		"LOG_FILE_MAX_SIZE and LOG_FILE_MAX_BACKUPS must be positive")
+	check(receiver.Messaging.EventsExchange != "", "EVENTS_EXCHANGE must not be empty")
+	check(receiver.Messaging.SpoolDir != "", "SPOOL_DIR must not be empty")
+
+	check(receiver.Services.TransactionAPI != "", "TRANSACTION_API_URL must not be empty")
+	check(receiver.Services.AccountStat != "", "ACCOUNT_STAT_URL must not be empty")
+	check(receiver.Services.Timeout > 0, "SERVICES_TIMEOUT must be positive")
+
+	check(oneOf(receiver.Tracing.Exporter, "none", "otlp", "stdout"),
+		"OTEL_TRACES_EXPORTER must be 'none', 'otlp' or 'stdout', got %q", receiver.Tracing.Exporter)
+
+	check(len(receiver.AccountTypesLimit) != 0, "ACCOUNT_TYPES_LIMIT must list at least one account type")
+	for t, limit := range receiver.AccountTypesLimit {
+		check(limit >= 0, "the limit of account type %q must not be negative", t)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Sinks returns the configured log sinks, or the default when none are configured.
+func (receiver Messaging) Sinks() []string {
+	if len(receiver.LogSinks) != 0 {
+		return receiver.LogSinks
+	}
+	if receiver.AMQPURL != "" {
+		return []string{"amqp"}
+	}
+	return []string{"stdout"}
+}
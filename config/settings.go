@@ -0,0 +1,209 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting binds a field of Config to an environment variable and, unless flag is empty, to a command-line flag.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	value flag.Value
+}
+
+// settings lists everything that can be set from the environment or the command line. Secrets have no flag, so
+// they don't end up in the process list.
+func (receiver *Config) settings() []setting {
+	return []setting{
+		{"SERVER_ADDR", "addr", "HTTP listen address", stringValue{&receiver.Server.Addr}},
+		{"GIN_MODE", "gin-mode", "gin mode: debug, release or test", stringValue{&receiver.Server.GinMode}},
+		{"SERVER_READ_TIMEOUT", "read-timeout", "HTTP read timeout", durationValue{&receiver.Server.ReadTimeout}},
+		{"SERVER_WRITE_TIMEOUT", "write-timeout", "HTTP write timeout", durationValue{&receiver.Server.WriteTimeout}},
+		{"SERVER_IDLE_TIMEOUT", "idle-timeout", "HTTP idle timeout", durationValue{&receiver.Server.IdleTimeout}},
+		{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "time to finish requests on shutdown",
+			durationValue{&receiver.Server.ShutdownTimeout}},
+		{"SHUTDOWN_DELAY", "shutdown-delay", "time readiness fails before shutdown",
+			durationValue{&receiver.Server.ShutdownDelay}},
+		{"READY_CHECK_TRANSACTION_API", "ready-check-transaction-api", "include the transaction API in /readyz",
+			boolValue{&receiver.Server.ReadyCheckTransactionAPI}},
+
+		{"DB_BACKEND", "db-backend", "database: dynamodb, postgres or memory", stringValue{&receiver.Database.Backend}},
+		{"DB_TIMEOUT", "db-timeout", "timeout of every database call", durationValue{&receiver.Database.Timeout}},
+		{"REGION", "region", "AWS region", stringValue{&receiver.Database.DynamoDB.Region}},
+		{"DYNAMODB_ENDPOINT", "dynamodb-endpoint", "DynamoDB endpoint, empty for AWS",
+			stringValue{&receiver.Database.DynamoDB.Endpoint}},
+		{"AWS_ACCESS_KEY_ID", "", "", stringValue{&receiver.Database.DynamoDB.AccessKeyID}},
+		{"AWS_SECRET_ACCESS_KEY", "", "", stringValue{&receiver.Database.DynamoDB.SecretAccessKey}},
+		{"DATABASE_URL", "", "", stringValue{&receiver.Database.PostgresURL}},
+		{"MIGRATE_MONEY", "migrate-money", "convert float amounts to cents on startup",
+			boolValue{&receiver.Database.MigrateMoney}},
+
+		{"JWT_SECRET", "", "", stringValue{&receiver.Auth.JWTSecret}},
+		{"JWT_HMAC_FALLBACK", "jwt-hmac-fallback", "accept HMAC tokens signed with JWT_SECRET",
+			boolValue{&receiver.Auth.HMACFallback}},
+		{"JWKS_URL", "jwks-url", "URL or file of the JSON Web Key Set for RS256 and ES256 tokens",
+			stringValue{&receiver.Auth.JWKSURL}},
+		{"JWKS_REFRESH_INTERVAL", "jwks-refresh-interval", "how often the JSON Web Key Set is loaded again",
+			durationValue{&receiver.Auth.JWKSRefreshInterval}},
+		{"JWT_ISSUER", "jwt-issuer", "required iss claim of tokens", stringValue{&receiver.Auth.Issuer}},
+		{"JWT_AUDIENCE", "jwt-audience", "required aud claim of tokens", stringValue{&receiver.Auth.Audience}},
+		{"JWT_CLOCK_SKEW", "jwt-clock-skew", "leeway for the exp, nbf and iat claims",
+			durationValue{&receiver.Auth.ClockSkew}},
+		{"CURSOR_SECRET", "", "", stringValue{&receiver.Auth.CursorSecret}},
+		{"AUDIT_SECRET", "", "", stringValue{&receiver.Auth.AuditSecret}},
+
+		{"AMQP_URL", "", "", stringValue{&receiver.Messaging.AMQPURL}},
+		{"EXCHANGE_QUEUE_NAME", "log-queue", "RabbitMQ queue for log records",
+			stringValue{&receiver.Messaging.LogQueue}},
+		{"EVENTS_EXCHANGE", "events-exchange", "RabbitMQ exchange for domain events",
+			stringValue{&receiver.Messaging.EventsExchange}},
+		{"SPOOL_DIR", "spool-dir", "directory for unpublished messages", stringValue{&receiver.Messaging.SpoolDir}},
+		{"LOG_SINKS", "log-sinks", "comma separated log sinks: amqp, file, stdout, nats",
+			listValue{&receiver.Messaging.LogSinks}},
+		{"LOG_FORMAT", "log-format", "log format: json or text", stringValue{&receiver.Messaging.LogFormat}},
+		{"LOG_FILE", "log-file", "log file of the file sink", stringValue{&receiver.Messaging.LogFile.Path}},
+		{"LOG_FILE_MAX_SIZE", "log-file-max-size", "log file size in megabytes before rotation",
+			intValue{&receiver.Messaging.LogFile.MaxSize}},
+		{"LOG_FILE_MAX_BACKUPS", "log-file-max-backups", "rotated log files to keep",
+			intValue{&receiver.Messaging.LogFile.MaxBackups}},
+		{"NATS_URL", "", "", stringValue{&receiver.Messaging.NATS.URL}},
+		{"NATS_SUBJECT", "nats-subject", "NATS subject for log records", stringValue{&receiver.Messaging.NATS.Subject}},
+
+		{"TRANSACTION_API_URL", "transaction-api-url", "transaction API base URL",
+			stringValue{&receiver.Services.TransactionAPI}},
+		{"ACCOUNT_STAT_URL", "account-stat-url", "account-stat base URL", stringValue{&receiver.Services.AccountStat}},
+		{"SERVICES_TIMEOUT", "services-timeout", "timeout of calls to other services",
+			durationValue{&receiver.Services.Timeout}},
+
+		{"OTEL_TRACES_EXPORTER", "traces-exporter", "trace exporter: none, otlp or stdout",
+			stringValue{&receiver.Tracing.Exporter}},
+
+		{"ACCOUNT_TYPES_LIMIT", "account-types-limit", "account types and their limits, e.g. checking=50,saving=10",
+			limitsValue{&receiver.AccountTypesLimit}},
+	}
+}
+
+type stringValue struct{ p *string }
+
+func (receiver stringValue) Set(s string) error {
+	*receiver.p = s
+	return nil
+}
+
+func (receiver stringValue) String() string {
+	if receiver.p == nil {
+		return ""
+	}
+	return *receiver.p
+}
+
+type intValue struct{ p *int }
+
+func (receiver intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", s)
+	}
+	*receiver.p = n
+	return nil
+}
+
+func (receiver intValue) String() string {
+	if receiver.p == nil {
+		return ""
+	}
+	return strconv.Itoa(*receiver.p)
+}
+
+type boolValue struct{ p *bool }
+
+func (receiver boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("%q is not true or false", s)
+	}
+	*receiver.p = b
+	return nil
+}
+
+func (receiver boolValue) String() string {
+	if receiver.p == nil {
+		return ""
+	}
+	return strconv.FormatBool(*receiver.p)
+}
+
+type durationValue struct{ p *time.Duration }
+
+func (receiver durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration such as 10s or 1m", s)
+	}
+	*receiver.p = d
+	return nil
+}
+
+func (receiver durationValue) String() string {
+	if receiver.p == nil {
+		return ""
+	}
+	return receiver.p.String()
+}
+
+type listValue struct{ p *[]string }
+
+func (receiver listValue) Set(s string) error {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*receiver.p = list
+	return nil
+}
+
+func (receiver listValue) String() string {
+	if receiver.p == nil {
+		return ""
+	}
+	return strings.Join(*receiver.p, ",")
+}
+
+// limitsValue parses a comma separated list of type=limit pairs.
+type limitsValue struct{ p *map[string]int }
+
+func (receiver limitsValue) Set(s string) error {
+	limits := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || name == "" {
+			return fmt.Errorf("%q is not type=limit", pair)
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("limit of %q is not a number", name)
+		}
+		limits[name] = limit
+	}
+	*receiver.p = limits
+	return nil
+}
+
+func (receiver limitsValue) String() string {
+	if receiver.p == nil {
+		return ""
+	}
+
+	var pairs []string
+	for name, limit := range *receiver.p {
+		pairs = append(pairs, name+"="+strconv.Itoa(limit))
+	}
+	return strings.Join(pairs, ",")
+}
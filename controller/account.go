@@ -10,12 +10,25 @@ import (
 	"main/response"
 	"main/util"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 )
 
 type AccountController struct {
-	DB *db.AccountDB
+	DB       db.AccountStore
+	Services util.Services
+	// TypesLimit maps every supported account type to its overdraft limit.
+	TypesLimit map[string]int
+}
+
+func (receiver AccountController) supportedTypes() string {
+	types := make([]string, 0, len(receiver.TypesLimit))
+	for t := range receiver.TypesLimit {
+		types = append(types, "'"+t+"'")
+	}
+	sort.Strings(types)
+	return strings.Join(types, ", ")
 }
 
 // Create godoc
@@ -28,9 +41,15 @@ type AccountController struct {
 //	@Param			requestBody	body		request.AccountRequest	true	"Account type"
 //	@Success		201			{object}	model.Account
 //	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		409			{object}	response.ErrorResponse
+//	@Failure		422			{object}	response.ErrorResponse
 //	@Failure		500			{object}	response.ErrorResponse
 //	@Security		JWT
 //	@Param			Authorization	header	string	true	"Authorization"
+//	@Param			userID			query	string	false	"User to act for, admins only"
+//	@Param			Idempotency-Key	header	string	false	"Key that makes retries of this request safe"
 //	@Router			/account [POST]
 func (receiver AccountController) Create(context *gin.Context) {
 	var req request.AccountRequest
@@ -42,8 +61,8 @@ func (receiver AccountController) Create(context *gin.Context) {
 
 	var limit int
 	var ok bool
-	if limit, ok = util.AccountTypesLimit[req.Type]; !ok {
-		err := context.Error(errors.New("invalid account type. Supported options are: 'checking', 'saving'"))
+	if limit, ok = receiver.TypesLimit[req.Type]; !ok {
+		err := context.Error(errors.New("invalid account type. Supported options are: " + receiver.supportedTypes()))
 		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
 		return
 	}
@@ -55,9 +74,10 @@ func (receiver AccountController) Create(context *gin.Context) {
 		Limit:    limit,
 		OpenDate: time.Now(),
 		Type:     req.Type,
+		Version:  1,
 	}
 
-	err := receiver.DB.Create(bankAccount)
+	err := receiver.DB.Create(context.Request.Context(), bankAccount)
 	if err != nil {
 		_ = context.Error(err)
 		if errors.Is(err, util.AlreadyExists) {
@@ -67,28 +87,65 @@ func (receiver AccountController) Create(context *gin.Context) {
 		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
 		return
 	}
-	//util.UploadAccount(bankAccount, context)
+	//receiver.Services.UploadAccount(bankAccount, context)
+	setETag(context, bankAccount.Version)
 	context.JSON(http.StatusCreated, bankAccount)
 }
 
 // GetAll godoc
 //
-//	@Description	Get accounts for a specific user.
+//	@Description	Get accounts for a specific user. The cursor for the next page is returned in the X-Next-Cursor header.
 //	@Summary		Get accounts for a specific user
 //	@Produce		json
 //	@Tags			account
 //	@Param			type	path		string			true	"What accounts to get: 'open', 'closed', 'all'"
+//	@Param			limit	query		int				false	"Page size, 1-100"	default(25)
+//	@Param			cursor	query		string			false	"Cursor from the X-Next-Cursor header of the previous page"
 //	@Success		200		{object}	[]model.Account	"An array of Account's"
+//	@Header			200		{string}	X-Next-Cursor	"Cursor for the next page, missing on the last page"
+//	@Success		204		"No Content"
 //	@Failure		400		{object}	response.ErrorResponse
+//	@Failure		401		{object}	response.ErrorResponse
+//	@Failure		403		{object}	response.ErrorResponse
 //	@Failure		500		{object}	response.ErrorResponse
 //	@Security		JWT
 //	@Param			Authorization	header	string	true	"Authorization"
+//	@Param			userID			query	string	false	"User to act for, admins only"
 //	@Router			/accounts/{type} [GET]
 func (receiver AccountController) GetAll(context *gin.Context) {
-	acc := receiver.get(context)
-	if acc != nil {
-		context.JSON(http.StatusOK, acc)
+	t, ok := accountsType(context)
+	if !ok {
+		return
+	}
+
+	limit, err := pageSize(context)
+	if err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	acc, next, err := receiver.DB.GetAllPage(context.Request.Context(), context.MustGet("ID").(string), t, limit,
+		context.Query("cursor"))
+	if err != nil {
+		_ = context.Error(err)
+		if errors.Is(err, util.InvalidCursor) {
+			context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+			return
+		}
+		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if next != "" {
+		context.Header("X-Next-Cursor", next)
+	}
+
+	if len(acc) == 0 {
+		context.Status(http.StatusNoContent)
+		return
 	}
+	context.JSON(http.StatusOK, acc)
 }
 
 func (receiver AccountController) depositWithdraw(context *gin.Context, deposit bool) {
@@ -106,28 +163,51 @@ func (receiver AccountController) depositWithdraw(context *gin.Context, deposit
 		return
 	}
 
-	if req.Amount < 1 {
+	if req.Amount < model.NewMoney(1) {
 		err := context.Error(errors.New("invalid amount, minimum is 1"))
 		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	version, checkVersion, err := ifMatch(context)
+	if err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	bankAccount := model.Account{
-		PK: util.GetPK(context.MustGet("ID").(string)),
-		SK: util.GetSK(accountID),
+		PK:           util.GetPK(context.MustGet("ID").(string)),
+		SK:           util.GetSK(accountID),
+		Version:      version,
+		CheckVersion: checkVersion,
 	}
 
 	if deposit {
-		err := receiver.DB.Deposit(bankAccount, req.Amount)
+		err := receiver.DB.Deposit(context.Request.Context(), bankAccount, req.Amount)
 		if err != nil {
 			_ = context.Error(err)
+			if versionError(context, err) || frozenError(context, err) {
+				return
+			}
+			if errors.Is(err, util.ClosedAccount) {
+				context.JSON(http.StatusConflict, response.ErrorResponse{Error: err.Error()})
+				return
+			}
 			context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
 			return
 		}
 	} else {
-		err := receiver.DB.Withdraw(bankAccount, req.Amount)
+		err := receiver.DB.Withdraw(context.Request.Context(), bankAccount, req.Amount)
 		if err != nil {
 			_ = context.Error(err)
+			if versionError(context, err) || frozenError(context, err) {
+				return
+			}
+			if errors.Is(err, util.ClosedAccount) {
+				context.JSON(http.StatusConflict, response.ErrorResponse{Error: err.Error()})
+				return
+			}
 			if errors.Is(err, util.InsufficientFounds) {
 				context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
 				return
@@ -148,9 +228,17 @@ func (receiver AccountController) depositWithdraw(context *gin.Context, deposit
 //	@Param			requestBody	body	request.MonetaryRequest	true	"Amount to deposit"
 //	@Success		204			"No Content"
 //	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		409			{object}	response.ErrorResponse
+//	@Failure		412			{object}	response.ErrorResponse
+//	@Failure		422			{object}	response.ErrorResponse
 //	@Failure		500			{object}	response.ErrorResponse
 //	@Security		JWT
 //	@Param			Authorization	header	string	true	"Authorization"
+//	@Param			userID			query	string	false	"User to act for, admins only"
+//	@Param			Idempotency-Key	header	string	false	"Key that makes retries of this request safe"
+//	@Param			If-Match		header	string	false	"ETag of the account; the request fails with 412 if the account has changed"
 //	@Router			/account/{accountID}/deposit [PATCH]
 func (receiver AccountController) Deposit(context *gin.Context) {
 	receiver.depositWithdraw(context, true)
@@ -165,9 +253,17 @@ func (receiver AccountController) Deposit(context *gin.Context) {
 //	@Param			requestBody	body	request.MonetaryRequest	true	"Amount to withdraw"
 //	@Success		204			"No Content"
 //	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		409			{object}	response.ErrorResponse
+//	@Failure		412			{object}	response.ErrorResponse
+//	@Failure		422			{object}	response.ErrorResponse
 //	@Failure		500			{object}	response.ErrorResponse
 //	@Security		JWT
 //	@Param			Authorization	header	string	true	"Authorization"
+//	@Param			userID			query	string	false	"User to act for, admins only"
+//	@Param			Idempotency-Key	header	string	false	"Key that makes retries of this request safe"
+//	@Param			If-Match		header	string	false	"ETag of the account; the request fails with 412 if the account has changed"
 //	@Router			/account/{accountID}/withdraw [PATCH]
 func (receiver AccountController) Withdraw(context *gin.Context) {
 	receiver.depositWithdraw(context, false)
@@ -181,9 +277,17 @@ func (receiver AccountController) Withdraw(context *gin.Context) {
 //	@Param			accountID	path	string	true	"Account ID"
 //	@Success		204			"No Content"
 //	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		409			{object}	response.ErrorResponse
+//	@Failure		412			{object}	response.ErrorResponse
+//	@Failure		422			{object}	response.ErrorResponse
 //	@Failure		500			{object}	response.ErrorResponse
 //	@Security		JWT
 //	@Param			Authorization	header	string	true	"Authorization"
+//	@Param			userID			query	string	false	"User to act for, admins only"
+//	@Param			Idempotency-Key	header	string	false	"Key that makes retries of this request safe"
+//	@Param			If-Match		header	string	false	"ETag of the account; the request fails with 412 if the account has changed"
 //	@Router			/account/{accountID}/close [PATCH]
 func (receiver AccountController) Close(context *gin.Context) {
 	accountID := context.Param("accountID")
@@ -193,14 +297,30 @@ func (receiver AccountController) Close(context *gin.Context) {
 		return
 	}
 
+	version, checkVersion, err := ifMatch(context)
+	if err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	bankAccount := model.Account{
-		PK: util.GetPK(context.MustGet("ID").(string)),
-		SK: util.GetSK(accountID),
+		PK:           util.GetPK(context.MustGet("ID").(string)),
+		SK:           util.GetSK(accountID),
+		Version:      version,
+		CheckVersion: checkVersion,
 	}
 
-	err := receiver.DB.Close(bankAccount)
+	err = receiver.DB.Close(context.Request.Context(), bankAccount)
 	if err != nil {
 		_ = context.Error(err)
+		if versionError(context, err) || frozenError(context, err) {
+			return
+		}
+		if errors.Is(err, util.AlreadyClosed) {
+			context.JSON(http.StatusConflict, response.ErrorResponse{Error: err.Error()})
+			return
+		}
 		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
 		return
 	}
@@ -215,9 +335,15 @@ func (receiver AccountController) Close(context *gin.Context) {
 //	@Param			accountID	path	string	true	"Account ID"
 //	@Success		204			"No Content"
 //	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		409			{object}	response.ErrorResponse
+//	@Failure		412			{object}	response.ErrorResponse
 //	@Failure		500			{object}	response.ErrorResponse
 //	@Security		JWT
 //	@Param			Authorization	header	string	true	"Authorization"
+//	@Param			userID			query	string	false	"User to act for, admins only"
+//	@Param			If-Match		header	string	false	"ETag of the account; the request fails with 412 if the account has changed"
 //	@Router			/account/{accountID} [DELETE]
 func (receiver AccountController) Delete(context *gin.Context) {
 	accountID := context.Param("accountID")
@@ -227,14 +353,26 @@ func (receiver AccountController) Delete(context *gin.Context) {
 		return
 	}
 
+	version, checkVersion, err := ifMatch(context)
+	if err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	bankAccount := model.Account{
-		PK: util.GetPK(context.MustGet("ID").(string)),
-		SK: util.GetSK(accountID),
+		PK:           util.GetPK(context.MustGet("ID").(string)),
+		SK:           util.GetSK(accountID),
+		Version:      version,
+		CheckVersion: checkVersion,
 	}
 
-	err := receiver.DB.Delete(bankAccount)
+	err = receiver.DB.Delete(context.Request.Context(), bankAccount)
 	if err != nil {
 		_ = context.Error(err)
+		if versionError(context, err) || frozenError(context, err) {
+			return
+		}
 		if errors.Is(err, util.InvalidAccount) || errors.Is(err, util.OpenAccount) {
 			context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
 			return
@@ -253,10 +391,14 @@ func (receiver AccountController) Delete(context *gin.Context) {
 //	@Tags			account
 //	@Param			accountID	path		string	true	"Account ID"
 //	@Success		200			{object}	model.Account
+//	@Header			200			{string}	ETag	"Account version, for the If-Match header"
 //	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
 //	@Failure		500			{object}	response.ErrorResponse
 //	@Security		JWT
 //	@Param			Authorization	header	string	true	"Authorization"
+//	@Param			userID			query	string	false	"User to act for, admins only"
 //	@Router			/account/{accountID} [GET]
 func (receiver AccountController) GetAccount(context *gin.Context) {
 	accountID := context.Param("accountID")
@@ -271,7 +413,7 @@ func (receiver AccountController) GetAccount(context *gin.Context) {
 		SK: util.GetSK(accountID),
 	}
 
-	acc, err := receiver.DB.GetAccount(bankAccount)
+	acc, err := receiver.DB.GetAccount(context.Request.Context(), bankAccount)
 	if err != nil {
 		_ = context.Error(err)
 		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
@@ -283,18 +425,27 @@ func (receiver AccountController) GetAccount(context *gin.Context) {
 		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
 		return
 	}
+	setETag(context, acc.Version)
 	context.JSON(http.StatusOK, acc)
 }
 
-func (receiver AccountController) get(context *gin.Context) []model.Account {
+func accountsType(context *gin.Context) (string, bool) {
 	t := context.Param("type")
 	if !(t == "open" || t == "closed" || t == "all") {
 		err := context.Error(errors.New("invalid type, supported: 'open', 'closed', all"))
 		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return "", false
+	}
+	return t, true
+}
+
+func (receiver AccountController) get(context *gin.Context) []model.Account {
+	t, ok := accountsType(context)
+	if !ok {
 		return nil
 	}
 
-	acc, err := receiver.DB.GetAll(context.MustGet("ID").(string), t)
+	acc, err := receiver.DB.GetAll(context.Request.Context(), context.MustGet("ID").(string), t)
 	if err != nil {
 		_ = context.Error(err)
 		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
@@ -317,9 +468,12 @@ func (receiver AccountController) get(context *gin.Context) []model.Account {
 //	@Param			type	path		string	true	"What accounts to get: 'open', 'closed', 'all'"
 //	@Success		200		{object}	[]model.Account
 //	@Failure		400		{object}	response.ErrorResponse
+//	@Failure		401		{object}	response.ErrorResponse
+//	@Failure		403		{object}	response.ErrorResponse
 //	@Failure		500		{object}	response.ErrorResponse
 //	@Security		JWT
 //	@Param			Authorization	header	string	true	"Authorization"
+//	@Param			userID			query	string	false	"User to act for, admins only"
 //	@Router			/accounts/{type}/transactions [GET]
 func (receiver AccountController) GetAllWithTransactions(context *gin.Context) {
 	acc := receiver.get(context)
@@ -329,8 +483,8 @@ func (receiver AccountController) GetAllWithTransactions(context *gin.Context) {
 
 	var accTr []model.Account
 	for _, v := range acc {
-		tr, err := util.GetTransactions(strings.Split(v.SK, "#")[1], context.MustGet("token").(string),
-			context.GetString("Correlation"))
+		tr, err := receiver.Services.GetTransactions(context.Request.Context(), strings.Split(v.SK, "#")[1],
+			context.MustGet("token").(string))
 
 		if err != nil {
 			_ = context.Error(err)
@@ -0,0 +1,345 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"main/db"
+	"main/model"
+	"main/request"
+	"main/response"
+	"main/util"
+	"net/http"
+	"strings"
+)
+
+// AdminController lets support staff look at and change the accounts of any user. Every action needs a reason,
+// which is written to the audit log together with the caller.
+type AdminController struct {
+	DB db.Store
+	// AuditSecret is the key the hashes of the audit log were computed with.
+	AuditSecret []byte
+}
+
+// frozenError writes the response for a change a frozen account does not allow and reports whether err was one.
+func frozenError(context *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, util.FrozenAccount):
+		context.JSON(http.StatusConflict, response.ErrorResponse{Error: err.Error()})
+	default:
+		return false
+	}
+	return true
+}
+
+// auditEntry returns the audit entry of action on the account in the path, or on all accounts of the user if the
+// path has no account. It writes a 400 response and returns false if the path or the reason is invalid.
+func auditEntry(context *gin.Context, action, reason string) (model.AuditEntry, bool) {
+	userID := context.Param("userID")
+	if !util.IsValidUUID(userID) {
+		err := context.Error(errors.New("invalid user id"))
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return model.AuditEntry{}, false
+	}
+
+	accountID := context.Param("accountID")
+	if accountID != "" && !util.IsValidUUID(accountID) {
+		err := context.Error(errors.New("invalid account id"))
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return model.AuditEntry{}, false
+	}
+
+	if strings.TrimSpace(reason) == "" {
+		err := context.Error(errors.New("reason is required"))
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return model.AuditEntry{}, false
+	}
+
+	entry := model.NewAuditEntry(userID, accountID, action, context.GetString("Subject"), reason)
+	entry.IP = context.ClientIP()
+	entry.CorrelationID = util.RequestID(context)
+	return entry, true
+}
+
+func adminAccount(entry model.AuditEntry) model.Account {
+	return model.Account{
+		PK: util.GetPK(entry.UserID),
+		SK: util.GetSK(entry.AccountID),
+	}
+}
+
+// adminError writes the response for a failed admin change.
+func adminError(context *gin.Context, err error) {
+	_ = context.Error(err)
+	switch {
+	case errors.Is(err, util.InvalidAccount):
+		context.JSON(http.StatusNotFound, response.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, util.AlreadyFrozen), errors.Is(err, util.NotFrozen), errors.Is(err, util.ClosedAccount),
+		errors.Is(err, util.AlreadyClosed), errors.Is(err, util.VersionMismatch), errors.Is(err, util.AuditConflict):
+		context.JSON(http.StatusConflict, response.ErrorResponse{Error: err.Error()})
+	default:
+		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
+	}
+}
+
+// ListAccounts godoc
+//
+//	@Description	List all accounts of a user. The cursor for the next page is returned in the X-Next-Cursor header.
+//	@Summary		List all accounts of a user
+//	@Produce		json
+//	@Tags			admin
+//	@Param			userID	path		string			true	"User ID"
+//	@Param			reason	query		string			true	"Why the accounts are looked at"
+//	@Param			limit	query		int				false	"Page size, 1-100"	default(25)
+//	@Param			cursor	query		string			false	"Cursor from the X-Next-Cursor header of the previous page"
+//	@Success		200		{object}	[]model.Account	"An array of Account's"
+//	@Header			200		{string}	X-Next-Cursor	"Cursor for the next page, missing on the last page"
+//	@Success		204		"No Content"
+//	@Failure		400		{object}	response.ErrorResponse
+//	@Failure		401		{object}	response.ErrorResponse
+//	@Failure		403		{object}	response.ErrorResponse
+//	@Failure		500		{object}	response.ErrorResponse
+//	@Security		JWT
+//	@Param			Authorization	header	string	true	"Authorization"
+//	@Router			/admin/users/{userID}/accounts [GET]
+func (receiver AdminController) ListAccounts(context *gin.Context) {
+	entry, ok := auditEntry(context, model.AuditViewAccounts, context.Query("reason"))
+	if !ok {
+		return
+	}
+
+	limit, err := pageSize(context)
+	if err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	acc, next, err := receiver.DB.GetAllPage(context.Request.Context(), entry.UserID, "all", limit,
+		context.Query("cursor"))
+	if err != nil {
+		_ = context.Error(err)
+		if errors.Is(err, util.InvalidCursor) {
+			context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+			return
+		}
+		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := receiver.DB.Audit(context.Request.Context(), entry); err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if next != "" {
+		context.Header("X-Next-Cursor", next)
+	}
+
+	if len(acc) == 0 {
+		context.Status(http.StatusNoContent)
+		return
+	}
+	context.JSON(http.StatusOK, acc)
+}
+
+// GetAccount godoc
+//
+//	@Description	Get any account of a user.
+//	@Summary		Get any account of a user
+//	@Produce		json
+//	@Tags			admin
+//	@Param			userID		path		string	true	"User ID"
+//	@Param			accountID	path		string	true	"Account ID"
+//	@Param			reason		query		string	true	"Why the account is looked at"
+//	@Success		200			{object}	model.Account
+//	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		404			{object}	response.ErrorResponse
+//	@Failure		500			{object}	response.ErrorResponse
+//	@Security		JWT
+//	@Param			Authorization	header	string	true	"Authorization"
+//	@Router			/admin/users/{userID}/accounts/{accountID} [GET]
+func (receiver AdminController) GetAccount(context *gin.Context) {
+	entry, ok := auditEntry(context, model.AuditViewAccount, context.Query("reason"))
+	if !ok {
+		return
+	}
+
+	acc, err := receiver.DB.GetAccount(context.Request.Context(), adminAccount(entry))
+	if err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if acc.PK == "" {
+		err := context.Error(util.InvalidAccount)
+		context.JSON(http.StatusNotFound, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := receiver.DB.Audit(context.Request.Context(), entry); err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+	context.JSON(http.StatusOK, acc)
+}
+
+func (receiver AdminController) freeze(context *gin.Context, frozen bool) {
+	var req request.AdminRequest
+	if err := context.ShouldBindJSON(&req); err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	action := model.AuditFreeze
+	if !frozen {
+		action = model.AuditUnfreeze
+	}
+
+	entry, ok := auditEntry(context, action, req.Reason)
+	if !ok {
+		return
+	}
+
+	acc, err := receiver.DB.Freeze(context.Request.Context(), adminAccount(entry), frozen, entry)
+	if err != nil {
+		adminError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, acc)
+}
+
+// Freeze godoc
+//
+//	@Description	Freeze an account. A frozen account can't be used for deposits, withdrawals or transfers, and its owner can't close or delete it.
+//	@Summary		Freeze an account
+//	@Accept			json
+//	@Produce		json
+//	@Tags			admin
+//	@Param			userID		path		string					true	"User ID"
+//	@Param			accountID	path		string					true	"Account ID"
+//	@Param			requestBody	body		request.AdminRequest	true	"Reason"
+//	@Success		200			{object}	model.Account
+//	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		404			{object}	response.ErrorResponse
+//	@Failure		409			{object}	response.ErrorResponse
+//	@Failure		500			{object}	response.ErrorResponse
+//	@Security		JWT
+//	@Param			Authorization	header	string	true	"Authorization"
+//	@Router			/admin/users/{userID}/accounts/{accountID}/freeze [POST]
+func (receiver AdminController) Freeze(context *gin.Context) {
+	receiver.freeze(context, true)
+}
+
+// Unfreeze godoc
+//
+//	@Description	Unfreeze a frozen account.
+//	@Summary		Unfreeze an account
+//	@Accept			json
+//	@Produce		json
+//	@Tags			admin
+//	@Param			userID		path		string					true	"User ID"
+//	@Param			accountID	path		string					true	"Account ID"
+//	@Param			requestBody	body		request.AdminRequest	true	"Reason"
+//	@Success		200			{object}	model.Account
+//	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		404			{object}	response.ErrorResponse
+//	@Failure		409			{object}	response.ErrorResponse
+//	@Failure		500			{object}	response.ErrorResponse
+//	@Security		JWT
+//	@Param			Authorization	header	string	true	"Authorization"
+//	@Router			/admin/users/{userID}/accounts/{accountID}/unfreeze [POST]
+func (receiver AdminController) Unfreeze(context *gin.Context) {
+	receiver.freeze(context, false)
+}
+
+// SetLimit godoc
+//
+//	@Description	Change the overdraft limit of an open account.
+//	@Summary		Change the limit of an account
+//	@Accept			json
+//	@Produce		json
+//	@Tags			admin
+//	@Param			userID		path		string					true	"User ID"
+//	@Param			accountID	path		string					true	"Account ID"
+//	@Param			requestBody	body		request.LimitRequest	true	"New limit and reason"
+//	@Success		200			{object}	model.Account
+//	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		404			{object}	response.ErrorResponse
+//	@Failure		409			{object}	response.ErrorResponse
+//	@Failure		500			{object}	response.ErrorResponse
+//	@Security		JWT
+//	@Param			Authorization	header	string	true	"Authorization"
+//	@Router			/admin/users/{userID}/accounts/{accountID}/limit [PATCH]
+func (receiver AdminController) SetLimit(context *gin.Context) {
+	var req request.LimitRequest
+	if err := context.ShouldBindJSON(&req); err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	entry, ok := auditEntry(context, model.AuditSetLimit, req.Reason)
+	if !ok {
+		return
+	}
+
+	acc, err := receiver.DB.SetLimit(context.Request.Context(), adminAccount(entry), *req.Limit, entry)
+	if err != nil {
+		adminError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, acc)
+}
+
+// ForceClose godoc
+//
+//	@Description	Close an account, even a frozen one, and unfreeze it so it can be deleted.
+//	@Summary		Force-close an account
+//	@Accept			json
+//	@Produce		json
+//	@Tags			admin
+//	@Param			userID		path		string					true	"User ID"
+//	@Param			accountID	path		string					true	"Account ID"
+//	@Param			requestBody	body		request.AdminRequest	true	"Reason"
+//	@Success		200			{object}	model.Account
+//	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		404			{object}	response.ErrorResponse
+//	@Failure		409			{object}	response.ErrorResponse
+//	@Failure		500			{object}	response.ErrorResponse
+//	@Security		JWT
+//	@Param			Authorization	header	string	true	"Authorization"
+//	@Router			/admin/users/{userID}/accounts/{accountID}/force-close [POST]
+func (receiver AdminController) ForceClose(context *gin.Context) {
+	var req request.AdminRequest
+	if err := context.ShouldBindJSON(&req); err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	entry, ok := auditEntry(context, model.AuditForceClose, req.Reason)
+	if !ok {
+		return
+	}
+
+	acc, err := receiver.DB.ForceClose(context.Request.Context(), adminAccount(entry), entry)
+	if err != nil {
+		adminError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, acc)
+}
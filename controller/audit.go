@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"main/db"
+	"main/metrics"
+	"main/model"
+	"main/request"
+	"main/response"
+	"main/util"
+	"net/http"
+)
+
+// AuditLog writes an audit entry for every request to the account endpoints it guards, whether it succeeds or not.
+type AuditLog struct {
+	DB db.Store
+}
+
+// detached keeps the values of ctx, such as the correlation ID, but not its cancellation, so an entry is still
+// written when the client has gone away.
+func detached(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
+
+func (receiver AuditLog) snapshot(context *gin.Context, userID, accountID string) *model.Account {
+	if accountID == "" {
+		return nil
+	}
+
+	acc, err := receiver.DB.GetAccount(detached(context.Request.Context()), model.Account{
+		PK: util.GetPK(userID),
+		SK: util.GetSK(accountID),
+	})
+	if err != nil || acc.PK == "" {
+		return nil
+	}
+	return &acc
+}
+
+// auditTarget is an account whose chain an entry is written to. An empty accountID is the chain of the actions that
+// are not on one account.
+type auditTarget struct {
+	userID    string
+	accountID string
+}
+
+// Record audits action on the account in the path. It must run after RequireScope, so the entry is written for the
+// user whose account is changed, and after Idempotency.Handle, so a replayed response is not audited again. The
+// snapshots are read right before and after the request, so they can include a concurrent change of the same
+// account.
+func (receiver AuditLog) Record(action string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		accountID := context.Param("accountID")
+		if !util.IsValidUUID(accountID) {
+			accountID = ""
+		}
+		receiver.record(context, action, auditTarget{userID: context.MustGet("ID").(string), accountID: accountID})
+	}
+}
+
+// RecordTransfer audits a transfer like Record, with an entry in the chain of the sender and, if the transfer
+// succeeded, one in the chain of the recipient, each with the snapshots of its account.
+func (receiver AuditLog) RecordTransfer(context *gin.Context) {
+	userID := context.MustGet("ID").(string)
+	targets := []auditTarget{{userID: userID}}
+
+	// The handler binds the body again, so it is read here and put back.
+	body, err := io.ReadAll(context.Request.Body)
+	context.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var req request.TransferRequest
+	if err == nil && json.Unmarshal(body, &req) == nil && util.IsValidUUID(req.SenderID) &&
+		util.IsValidUUID(req.RecipientID) {
+
+		targets[0].accountID = req.SenderID
+		recipient := auditTarget{userID: userID, accountID: req.RecipientID}
+		if req.RecipientUserID != "" {
+			recipient.userID = req.RecipientUserID
+		}
+		if util.IsValidUUID(recipient.userID) {
+			targets = append(targets, recipient)
+		}
+	}
+	receiver.record(context, model.AuditTransfer, targets...)
+}
+
+func (receiver AuditLog) record(context *gin.Context, action string, targets ...auditTarget) {
+	before := make([]*model.Account, len(targets))
+	for i, target := range targets {
+		before[i] = receiver.snapshot(context, target.userID, target.accountID)
+	}
+
+	recorder := &responseRecorder{ResponseWriter: context.Writer}
+	context.Writer = recorder
+	context.Next()
+
+	// A new account is only known from the response.
+	if targets[0].accountID == "" && recorder.Status() == http.StatusCreated {
+		var created model.Account
+		if err := json.Unmarshal(recorder.body.Bytes(), &created); err == nil && util.IsValidUUID(created.SK) {
+			targets[0].accountID = created.SK
+		}
+	}
+
+	failed := recorder.Status() >= http.StatusBadRequest
+	for i, target := range targets {
+		// A failed request changed nothing, so it stays in the chain of the caller's account.
+		if failed && i > 0 {
+			break
+		}
+
+		entry := model.NewAuditEntry(target.userID, target.accountID, action, context.GetString("Subject"), "")
+		entry.IP = context.ClientIP()
+		entry.CorrelationID = util.RequestID(context)
+		entry.Status = recorder.Status()
+		entry.Before = before[i]
+		entry.After = receiver.snapshot(context, target.userID, target.accountID)
+		if failed {
+			entry.Outcome = model.AuditFailure
+			if err := context.Errors.Last(); err != nil {
+				entry.Error = err.Error()
+			}
+		}
+
+		// The change is already committed, so a lost entry can only be reported.
+		if err := receiver.DB.Audit(detached(context.Request.Context()), entry); err != nil {
+			metrics.ObserveAuditError(action)
+			_ = context.Error(fmt.Errorf("audit entry for %s was not written: %w", action, err))
+		}
+	}
+}
+
+func (receiver AdminController) verifyAudit(context *gin.Context) {
+	userID := context.Param("userID")
+	if !util.IsValidUUID(userID) {
+		err := context.Error(errors.New("invalid user id"))
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	accountID := context.Param("accountID")
+	if accountID != "" && !util.IsValidUUID(accountID) {
+		err := context.Error(errors.New("invalid account id"))
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	entries, err := receiver.DB.AuditTrail(context.Request.Context(), userID, accountID)
+	if err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	verification := response.AuditVerification{
+		Entries:  len(entries),
+		BrokenAt: model.VerifyAuditChain(entries, receiver.AuditSecret),
+	}
+	verification.Valid = verification.BrokenAt == 0
+	if len(entries) != 0 {
+		verification.LastHash = entries[len(entries)-1].Hash
+	}
+	context.JSON(http.StatusOK, verification)
+}
+
+// VerifyAudit godoc
+//
+//	@Description	Verify the audit chain of an account. Every entry holds the hash of the entry before it, so a changed or removed entry breaks the chain.
+//	@Summary		Verify the audit chain of an account
+//	@Produce		json
+//	@Tags			admin
+//	@Param			userID		path		string	true	"User ID"
+//	@Param			accountID	path		string	true	"Account ID"
+//	@Success		200			{object}	response.AuditVerification
+//	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		500			{object}	response.ErrorResponse
+//	@Security		JWT
+//	@Param			Authorization	header	string	true	"Authorization"
+//	@Router			/admin/users/{userID}/accounts/{accountID}/audit/verify [GET]
+func (receiver AdminController) VerifyAudit(context *gin.Context) {
+	receiver.verifyAudit(context)
+}
+
+// VerifyUserAudit godoc
+//
+//	@Description	Verify the audit chain of the actions that are not on one account, such as listing the accounts of a user or a failed attempt to open one.
+//	@Summary		Verify the audit chain of a user
+//	@Produce		json
+//	@Tags			admin
+//	@Param			userID	path		string	true	"User ID"
+//	@Success		200		{object}	response.AuditVerification
+//	@Failure		400		{object}	response.ErrorResponse
+//	@Failure		401		{object}	response.ErrorResponse
+//	@Failure		403		{object}	response.ErrorResponse
+//	@Failure		500		{object}	response.ErrorResponse
+//	@Security		JWT
+//	@Param			Authorization	header	string	true	"Authorization"
+//	@Router			/admin/users/{userID}/audit/verify [GET]
+func (receiver AdminController) VerifyUserAudit(context *gin.Context) {
+	receiver.verifyAudit(context)
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"main/response"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const readinessTimeout = 2 * time.Second
+
+var errDisconnected = errors.New("not connected")
+
+// Connection is a broker connection whose state is reported by the health endpoints.
+type Connection struct {
+	Name    string
+	Checker interface {
+		Connected() bool
+	}
+}
+
+// Check is a dependency that must be reachable for the service to be ready.
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type HealthController struct {
+	Connections []Connection
+	Checks      []Check
+
+	shuttingDown atomic.Bool
+}
+
+// ShutDown makes the readiness check fail from now on, so no new traffic is sent while the server drains.
+func (receiver *HealthController) ShutDown() {
+	receiver.shuttingDown.Store(true)
+}
+
+// Health reports the state of the broker connections. The service keeps serving requests while a broker is down,
+// so the status is then 'degraded' and the response is still 200.
+func (receiver *HealthController) Health(context *gin.Context) {
+	health := response.HealthResponse{
+		Status:      "ok",
+		Connections: make(map[string]string, len(receiver.Connections)),
+	}
+
+	for _, connection := range receiver.Connections {
+		if connection.Checker.Connected() {
+			health.Connections[connection.Name] = "connected"
+		} else {
+			health.Connections[connection.Name] = "disconnected"
+			health.Status = "degraded"
+		}
+	}
+	context.JSON(http.StatusOK, health)
+}
+
+// Live reports that the process is up and serving requests.
+func (receiver *HealthController) Live(context *gin.Context) {
+	context.JSON(http.StatusOK, response.HealthResponse{Status: "ok"})
+}
+
+func connectionCheck(connection Connection) Check {
+	return Check{
+		Name: connection.Name,
+		Check: func(context.Context) error {
+			if !connection.Checker.Connected() {
+				return errDisconnected
+			}
+			return nil
+		},
+	}
+}
+
+func runCheck(check Check) response.CheckResult {
+	ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	result := response.CheckResult{
+		Status:    "ok",
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = "failed"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Ready runs every check and the connection checks in parallel. It fails with 503 when one of Checks fails or when
+// the shutdown has begun. A connection that is down is only reported as 'degraded', because the outbox, the log
+// buffer and the spool keep the service working without it, and failing would take every replica out of rotation.
+func (receiver *HealthController) Ready(context *gin.Context) {
+	checks := append([]Check(nil), receiver.Checks...)
+	for _, connection := range receiver.Connections {
+		checks = append(checks, connectionCheck(connection))
+	}
+
+	results := make([]response.CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = runCheck(check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	ready := response.ReadinessResponse{
+		Status: "ok",
+		Checks: make(map[string]response.CheckResult, len(checks)),
+	}
+	for i, check := range checks {
+		switch {
+		case results[i].Status == "ok":
+		case i >= len(receiver.Checks):
+			results[i].Status = "degraded"
+		default:
+			ready.Status = "failed"
+		}
+		ready.Checks[check.Name] = results[i]
+	}
+
+	if receiver.shuttingDown.Load() {
+		ready.Status = "shutting down"
+	}
+
+	if ready.Status != "ok" {
+		context.JSON(http.StatusServiceUnavailable, ready)
+		return
+	}
+	context.JSON(http.StatusOK, ready)
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"main/db"
+	"main/model"
+	"main/response"
+	"main/util"
+	"net/http"
+	"time"
+)
+
+const idempotencyTTL = 24 * time.Hour
+const maxIdempotencyKeyLength = 255
+
+// idempotencyLease is how long a key stays reserved while its first request runs. It is longer than any request
+// may run, so a key whose request was lost in a crash can be used again after it.
+const idempotencyLease = time.Minute
+
+// replayedHeaders are the response headers that are stored and replayed together with the body.
+var replayedHeaders = []string{"ETag", "Location"}
+
+// Idempotency makes retries of money-moving requests safe. The first response for an Idempotency-Key header is
+// stored and replayed for every later request with the same key and body.
+type Idempotency struct {
+	DB db.IdempotencyStore
+}
+
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (receiver *responseRecorder) Write(data []byte) (int, error) {
+	receiver.body.Write(data)
+	return receiver.ResponseWriter.Write(data)
+}
+
+func (receiver *responseRecorder) WriteString(s string) (int, error) {
+	receiver.body.WriteString(s)
+	return receiver.ResponseWriter.WriteString(s)
+}
+
+func fingerprint(context *gin.Context, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(context.Request.Method + " " + context.Request.URL.Path + "?" + context.Request.URL.RawQuery +
+		"\n" + context.GetString("Subject") + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (receiver Idempotency) Handle(context *gin.Context) {
+	key := context.GetHeader("Idempotency-Key")
+	if key == "" {
+		context.Next()
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		err := context.Error(errors.New("Idempotency-Key is too long"))
+		context.AbortWithStatusJSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(context.Request.Body)
+	if err != nil {
+		_ = context.Error(err)
+		context.AbortWithStatusJSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+	context.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	record := model.IdempotencyRecord{
+		PK:          util.GetPK(context.MustGet("ID").(string)),
+		SK:          "IDEMPOTENCY#" + key,
+		Fingerprint: fingerprint(context, body),
+		ExpiresAt:   time.Now().Add(idempotencyLease).Unix(),
+	}
+
+	stored, reserved, err := receiver.DB.ReserveIdempotency(context.Request.Context(), record)
+	if err != nil {
+		_ = context.Error(err)
+		context.AbortWithStatusJSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !reserved {
+		if stored.Fingerprint != record.Fingerprint {
+			err := context.Error(errors.New("Idempotency-Key was already used for a different request"))
+			context.AbortWithStatusJSON(http.StatusUnprocessableEntity, response.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		if stored.Status == 0 {
+			err := context.Error(errors.New("a request with this Idempotency-Key is still in progress"))
+			context.AbortWithStatusJSON(http.StatusConflict, response.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		for name, value := range stored.Headers {
+			context.Header(name, value)
+		}
+		context.Header("Idempotent-Replayed", "true")
+		context.Data(stored.Status, stored.ContentType, stored.Body)
+		context.Abort()
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: context.Writer}
+	context.Writer = recorder
+	context.Next()
+
+	// Server errors are not stored, so the client can retry them with the same key.
+	if recorder.Status() >= http.StatusInternalServerError {
+		if err := receiver.DB.DeleteIdempotency(context.Request.Context(), record); err != nil {
+			log.Printf("DeleteIdempotency error: %v", err)
+		}
+		return
+	}
+
+	record.Status = recorder.Status()
+	record.ContentType = recorder.Header().Get("Content-Type")
+	record.Body = recorder.body.Bytes()
+	for _, name := range replayedHeaders {
+		if value := recorder.Header().Get(name); value != "" {
+			if record.Headers == nil {
+				record.Headers = make(map[string]string)
+			}
+			record.Headers[name] = value
+		}
+	}
+	record.ExpiresAt = time.Now().Add(idempotencyTTL).Unix()
+	if err := receiver.DB.SaveIdempotency(context.Request.Context(), record); err != nil {
+		log.Printf("SaveIdempotency error: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"main/model"
+	"main/response"
+	"main/util"
+	"net/http"
+	"strconv"
+)
+
+const defaultPageSize = 25
+const maxPageSize = 100
+
+func pageSize(context *gin.Context) (int32, error) {
+	value := context.Query("limit")
+	if value == "" {
+		return defaultPageSize, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, errors.New("invalid limit, supported range is 1-" + strconv.Itoa(maxPageSize))
+	}
+	return int32(limit), nil
+}
+
+// GetLedger godoc
+//
+//	@Description	Get the ledger of balance movements for a specific account, newest first. The cursor for the next page is returned in the X-Next-Cursor header.
+//	@Summary		Get the ledger of a specific account
+//	@Produce		json
+//	@Tags			account
+//	@Param			accountID	path		string	true	"Account ID"
+//	@Param			limit		query		int		false	"Page size, 1-100"	default(25)
+//	@Param			cursor		query		string	false	"Cursor from the X-Next-Cursor header of the previous page"
+//	@Success		200			{object}	[]model.LedgerEntry
+//	@Header			200			{string}	X-Next-Cursor	"Cursor for the next page, missing on the last page"
+//	@Success		204			"No Content"
+//	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		500			{object}	response.ErrorResponse
+//	@Security		JWT
+//	@Param			Authorization	header	string	true	"Authorization"
+//	@Param			userID			query	string	false	"User to act for, admins only"
+//	@Router			/account/{accountID}/ledger [GET]
+func (receiver AccountController) GetLedger(context *gin.Context) {
+	accountID := context.Param("accountID")
+	if !util.IsValidUUID(accountID) {
+		err := context.Error(errors.New("invalid account id"))
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	limit, err := pageSize(context)
+	if err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	bankAccount := model.Account{
+		PK: util.GetPK(context.MustGet("ID").(string)),
+		SK: util.GetSK(accountID),
+	}
+
+	entries, next, err := receiver.DB.GetLedger(context.Request.Context(), bankAccount, limit, context.Query("cursor"))
+	if err != nil {
+		_ = context.Error(err)
+		if errors.Is(err, util.InvalidCursor) {
+			context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+			return
+		}
+		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if next != "" {
+		context.Header("X-Next-Cursor", next)
+	}
+
+	if len(entries) == 0 {
+		context.Status(http.StatusNoContent)
+		return
+	}
+	context.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"main/model"
+	"main/request"
+	"main/response"
+	"main/util"
+	"net/http"
+)
+
+// Transfer godoc
+//
+//	@Description	Transfer money from one account to another in a single atomic write.
+//	@Summary		Transfer money between accounts
+//	@Accept			json
+//	@Tags			transfer
+//	@Param			requestBody	body	request.TransferRequest	true	"Transfer details"
+//	@Success		204			"No Content"
+//	@Failure		400			{object}	response.ErrorResponse
+//	@Failure		401			{object}	response.ErrorResponse
+//	@Failure		403			{object}	response.ErrorResponse
+//	@Failure		409			{object}	response.ErrorResponse
+//	@Failure		412			{object}	response.ErrorResponse
+//	@Failure		422			{object}	response.ErrorResponse
+//	@Failure		500			{object}	response.ErrorResponse
+//	@Security		JWT
+//	@Param			Authorization	header	string	true	"Authorization"
+//	@Param			userID			query	string	false	"User to act for, admins only"
+//	@Param			Idempotency-Key	header	string	false	"Key that makes retries of this request safe"
+//	@Param			If-Match		header	string	false	"ETag of the sender account; the request fails with 412 if it has changed"
+//	@Router			/transfers [POST]
+func (receiver AccountController) Transfer(context *gin.Context) {
+	var req request.TransferRequest
+	if err := context.ShouldBindJSON(&req); err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !util.IsValidUUID(req.SenderID) || !util.IsValidUUID(req.RecipientID) {
+		err := context.Error(errors.New("invalid account id"))
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userID := context.MustGet("ID").(string)
+	recipientUserID := userID
+	if req.RecipientUserID != "" {
+		if !util.IsValidUUID(req.RecipientUserID) {
+			err := context.Error(errors.New("invalid recipient user id"))
+			context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+			return
+		}
+		recipientUserID = req.RecipientUserID
+	}
+
+	if req.Amount < model.NewMoney(1) {
+		err := context.Error(errors.New("invalid amount, minimum is 1"))
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	version, checkVersion, err := ifMatch(context)
+	if err != nil {
+		_ = context.Error(err)
+		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	sender := model.Account{
+		PK:           util.GetPK(userID),
+		SK:           util.GetSK(req.SenderID),
+		Version:      version,
+		CheckVersion: checkVersion,
+	}
+	recipient := model.Account{
+		PK: util.GetPK(recipientUserID),
+		SK: util.GetSK(req.RecipientID),
+	}
+
+	err = receiver.DB.Transfer(context.Request.Context(), sender, recipient, req.Amount)
+	if err != nil {
+		_ = context.Error(err)
+		if versionError(context, err) || frozenError(context, err) {
+			return
+		}
+		if errors.Is(err, util.InsufficientFounds) || errors.Is(err, util.InvalidAccount) ||
+			errors.Is(err, util.ClosedAccount) || errors.Is(err, util.SameAccount) {
+			context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+			return
+		}
+		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
+		return
+	}
+	context.Status(http.StatusNoContent)
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"main/response"
+	"main/util"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ifMatch returns the account version from the If-Match header and whether the request has a precondition at all,
+// which is not the case for a missing header or '*'.
+func ifMatch(context *gin.Context) (int64, bool, error) {
+	value := strings.TrimSpace(context.GetHeader("If-Match"))
+	if value == "" || value == "*" {
+		return 0, false, nil
+	}
+
+	value = strings.TrimPrefix(value, "W/")
+	if len(value) < 2 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		return 0, false, errors.New("invalid If-Match header")
+	}
+
+	version, err := strconv.ParseInt(value[1:len(value)-1], 10, 64)
+	if err != nil || version < 0 {
+		return 0, false, errors.New("invalid If-Match header")
+	}
+	return version, true, nil
+}
+
+func setETag(context *gin.Context, version int64) {
+	context.Header("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+// versionError writes the response for a failed version check and reports whether err was one.
+func versionError(context *gin.Context, err error) bool {
+	if errors.Is(err, util.VersionMismatch) {
+		context.JSON(http.StatusPreconditionFailed, response.ErrorResponse{Error: err.Error()})
+		return true
+	}
+	return false
+}
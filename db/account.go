@@ -7,23 +7,34 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"main/model"
 	"main/util"
+	"strings"
 	"time"
 )
 
 type AccountDB struct {
 	Client *dynamodb.Client
+	// Timeout bounds every call to DynamoDB. Zero means 10 seconds.
+	Timeout time.Duration
+	// CursorSecret signs the continuation tokens of paged results.
+	CursorSecret []byte
+	// AuditSecret keys the hashes of the audit log.
+	AuditSecret []byte
 }
 
-func (receiver AccountDB) Create(account model.Account) error {
+func (receiver AccountDB) Create(ctx context.Context, account model.Account) error {
 	accItem, err := attributevalue.MarshalMap(account)
 	if err != nil {
 		return err
 	}
+	if accItem["Available"], err = attributevalue.Marshal(available(account)); err != nil {
+		return err
+	}
 
 	keyCond, filter := getKeyConAndFilter(account.PK, account.Type)
-	accounts, err := receiver.getAll(keyCond, filter, true)
+	accounts, err := receiver.getAll(ctx, keyCond, filter, true)
 	if err != nil {
 		return err
 	}
@@ -31,15 +42,33 @@ func (receiver AccountDB) Create(account model.Account) error {
 		return util.AlreadyExists
 	}
 
-	accInput := &dynamodb.PutItemInput{
-		Item:      accItem,
-		TableName: aws.String(util.TableName),
+	eventPut, err := outboxPut(ctx, model.NewAccountOpened(account))
+	if err != nil {
+		return err
+	}
+
+	countUpdate, err := openCountUpdate(account.Type, 1)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					Item:      accItem,
+					TableName: aws.String(util.TableName),
+				},
+			},
+			eventPut,
+			countUpdate,
+		},
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
 	defer cancel()
 
-	_, err = receiver.Client.PutItem(ctx, accInput)
+	_, err = receiver.Client.TransactWriteItems(ctx, input)
 	return err
 }
 
@@ -52,7 +81,13 @@ func getKeyConAndFilter(id string, t string) (expression.KeyConditionBuilder, ex
 	return keyCond, filter
 }
 
-func (receiver AccountDB) GetAll(id, t string) ([]model.Account, error) {
+func (receiver AccountDB) GetAll(ctx context.Context, id, t string) ([]model.Account, error) {
+	keyCond, filter, isFilter := getTypeFilter(id, t)
+	return receiver.getAll(ctx, keyCond, filter, isFilter)
+}
+
+// getTypeFilter returns the query for the accounts of user id that are 'open', 'closed' or, for any other t, all.
+func getTypeFilter(id, t string) (expression.KeyConditionBuilder, expression.ConditionBuilder, bool) {
 	keyCond, _ := getKeyConAndFilter(id, "")
 
 	var filter expression.ConditionBuilder
@@ -64,11 +99,11 @@ func (receiver AccountDB) GetAll(id, t string) ([]model.Account, error) {
 	} else {
 		isFilter = false
 	}
-	return receiver.getAll(keyCond, filter, isFilter)
+	return keyCond, filter, isFilter
 }
 
-func (receiver AccountDB) getAll(keyCond expression.KeyConditionBuilder, filter expression.ConditionBuilder,
-	isFilter bool) ([]model.Account, error) {
+func accountQuery(keyCond expression.KeyConditionBuilder, filter expression.ConditionBuilder,
+	isFilter bool) (*dynamodb.QueryInput, error) {
 
 	var expr expression.Expression
 	var err error
@@ -91,27 +126,87 @@ func (receiver AccountDB) getAll(keyCond expression.KeyConditionBuilder, filter
 	if isFilter {
 		input.FilterExpression = expr.Filter()
 	}
+	return input, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// getAll returns every matching account, following all result pages.
+func (receiver AccountDB) getAll(ctx context.Context, keyCond expression.KeyConditionBuilder,
+	filter expression.ConditionBuilder, isFilter bool) ([]model.Account, error) {
 
-	result, err := receiver.Client.Query(ctx, input)
+	input, err := accountQuery(keyCond, filter, isFilter)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(result.Items) == 0 {
-		return nil, nil
+	var accounts []model.Account
+	paginator := dynamodb.NewQueryPaginator(receiver.Client, input)
+	for paginator.HasMorePages() {
+		ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		var items []model.Account
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, items...)
+	}
+	return accounts, nil
+}
+
+func (receiver AccountDB) GetAllPage(ctx context.Context, id, t string, limit int32,
+	cursor string) ([]model.Account, string, error) {
+
+	position, err := decodeCursor(receiver.CursorSecret, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if position != nil && (position["PK"] != util.GetPK(id) || !strings.HasPrefix(position["SK"], "ACCOUNT#")) {
+		return nil, "", util.InvalidCursor
+	}
+
+	input, err := accountQuery(getTypeFilter(id, t))
+	if err != nil {
+		return nil, "", err
 	}
+	input.ExclusiveStartKey = positionToKey(position)
+	input.Limit = aws.Int32(limit)
 
+	// The filter is applied after Limit, so a single query can return fewer accounts than asked for, even none.
 	var accounts []model.Account
-	if err := attributevalue.UnmarshalListOfMaps(result.Items, &accounts); err != nil {
-		return nil, err
+	for {
+		ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+		result, err := receiver.Client.Query(ctx, input)
+		cancel()
+		if err != nil {
+			return nil, "", err
+		}
+
+		var items []model.Account
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &items); err != nil {
+			return nil, "", err
+		}
+		accounts = append(accounts, items...)
+
+		more := len(result.LastEvaluatedKey) != 0
+		if len(accounts) > int(limit) {
+			accounts, more = accounts[:limit], true
+		}
+		if !more {
+			return accounts, "", nil
+		}
+		if len(accounts) == int(limit) {
+			last := accounts[len(accounts)-1]
+			return accounts, encodeCursor(receiver.CursorSecret, map[string]string{"PK": last.PK, "SK": last.SK}), nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
 	}
-	return accounts, nil
 }
 
-func (receiver AccountDB) GetAccount(account model.Account) (model.Account, error) {
+func (receiver AccountDB) GetAccount(ctx context.Context, account model.Account) (model.Account, error) {
 	primaryKey := map[string]string{
 		"PK": util.GetPK(account.PK),
 		"SK": util.GetSK(account.SK),
@@ -128,7 +223,7 @@ func (receiver AccountDB) GetAccount(account model.Account) (model.Account, erro
 		ConsistentRead: aws.Bool(true),
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
 	defer cancel()
 
 	result, err := receiver.Client.GetItem(ctx, input)
@@ -143,7 +238,55 @@ func (receiver AccountDB) GetAccount(account model.Account) (model.Account, erro
 	return acc, nil
 }
 
-func (receiver AccountDB) depositWithdraw(account model.Account, amount float64, deposit bool) error {
+// versionCondition checks that the stored account still has the given version. Accounts written before versioning
+// have no Version attribute and count as version 0.
+func versionCondition(version int64) expression.ConditionBuilder {
+	if version == 0 {
+		return expression.Name("Version").AttributeNotExists()
+	}
+	return expression.Name("Version").Equal(expression.Value(version))
+}
+
+// notFrozen is part of the condition of every change a frozen account does not allow.
+func notFrozen() expression.ConditionBuilder {
+	return expression.Name("Frozen").AttributeNotExists()
+}
+
+// incrementVersion adds the version bump that every account update must carry.
+func incrementVersion(upd expression.UpdateBuilder) expression.UpdateBuilder {
+	return upd.Set(expression.Name("Version"), expression.Plus(
+		expression.IfNotExists(expression.Name("Version"), expression.Value(0)), expression.Value(1)))
+}
+
+// available is what can be taken from acc. DynamoDB conditions can't do arithmetic, so it is stored as the Available
+// attribute and changed together with Amount and Limit. Accounts written before it get it on their first change.
+func available(acc model.Account) model.Money {
+	return acc.Amount + model.NewMoney(int64(acc.Limit))
+}
+
+// debitCondition allows taking amount only while the balance stays within the stored limit.
+func debitCondition(amount model.Money) expression.ConditionBuilder {
+	return expression.Name("Available").GreaterThanEqual(expression.Value(amount))
+}
+
+// creditCondition makes a credit to an account without the Available attribute fail its condition, so it can be
+// added and the write retried.
+func creditCondition() expression.ConditionBuilder {
+	return expression.Name("Available").AttributeExists()
+}
+
+// changeAmount changes the balance by amount, which is negative for a debit.
+func changeAmount(amount model.Money) expression.UpdateBuilder {
+	return expression.Set(expression.Name("Amount"), expression.Plus(expression.Name("Amount"),
+		expression.Value(amount))).
+		Set(expression.Name("Available"), expression.Plus(expression.Name("Available"), expression.Value(amount)))
+}
+
+// depositWithdraw applies the change in one conditional write, so concurrent requests can't overdraw the account.
+// account.Version is the version the client expects and is only checked if account.CheckVersion is set.
+func (receiver AccountDB) depositWithdraw(ctx context.Context, account model.Account, amount model.Money,
+	deposit bool) error {
+
 	primaryKey := map[string]string{
 		"PK": util.GetPK(account.PK),
 		"SK": util.GetSK(account.SK),
@@ -154,67 +297,305 @@ func (receiver AccountDB) depositWithdraw(account model.Account, amount float64,
 		return err
 	}
 
-	acc, err := receiver.GetAccount(account)
+	acc, err := receiver.GetAccount(ctx, account)
 	if err != nil || acc.PK == "" {
-		return errors.New("invalid account")
+		return util.InvalidAccount
 	}
 
-	if acc.CloseDate != nil && !acc.CloseDate.IsZero() {
-		return errors.New("account is closed")
+	if account.CheckVersion && acc.Version != account.Version {
+		return util.VersionMismatch
 	}
 
-	cond := expression.Name("CloseDate").AttributeNotExists()
+	if acc.Frozen {
+		return util.FrozenAccount
+	}
+
+	if acc.CloseDate != nil && !acc.CloseDate.IsZero() {
+		return util.ClosedAccount
+	}
 
 	var upd expression.UpdateBuilder
-	var expr expression.Expression
+	var entry model.LedgerEntry
+	var event model.Event
 
+	cond := expression.Name("PK").AttributeExists().And(expression.Name("CloseDate").AttributeNotExists()).
+		And(notFrozen())
 	if deposit {
-		upd = expression.Set(expression.Name("Amount"), expression.Plus(expression.Name("Amount"),
-			expression.Value(amount)))
+		upd = changeAmount(amount)
+		cond = cond.And(creditCondition())
+		entry = model.NewLedgerEntry(acc, model.LedgerDeposit, amount, "")
+		event = model.NewAccountDeposited(acc, amount, "")
 	} else {
-		acc, er := receiver.GetAccount(account)
-		if er != nil {
-			return er
-		}
+		upd = changeAmount(-amount)
+		cond = cond.And(debitCondition(amount))
+		entry = model.NewLedgerEntry(acc, model.LedgerWithdrawal, -amount, "")
+		event = model.NewAccountWithdrawn(acc, amount, "")
+	}
+	versions := map[int]int64{}
+	if account.CheckVersion {
+		cond = cond.And(versionCondition(account.Version))
+		versions[0] = account.Version
+	}
 
-		if acc.Amount-amount < float64(-1*acc.Limit) {
-			return util.InsufficientFounds
-		}
+	expr, err := expression.NewBuilder().WithUpdate(incrementVersion(upd)).WithCondition(cond).Build()
+	if err != nil {
+		return err
+	}
 
-		upd = expression.Set(expression.Name("Amount"), expression.Minus(expression.Name("Amount"),
-			expression.Value(amount)))
+	ledgerPut, err := ledgerPut(entry)
+	if err != nil {
+		return err
 	}
-	expr, err = expression.NewBuilder().WithUpdate(upd).WithCondition(cond).Build()
 
+	eventPut, err := outboxPut(ctx, event)
 	if err != nil {
 		return err
 	}
 
-	input := &dynamodb.UpdateItemInput{
-		Key:                       pk,
-		TableName:                 aws.String(util.TableName),
-		ConditionExpression:       expr.Condition(),
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		UpdateExpression:          expr.Update(),
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					Key:                                 pk,
+					TableName:                           aws.String(util.TableName),
+					ConditionExpression:                 expr.Condition(),
+					ExpressionAttributeNames:            expr.Names(),
+					ExpressionAttributeValues:           expr.Values(),
+					UpdateExpression:                    expr.Update(),
+					ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+				},
+			},
+			ledgerPut,
+			eventPut,
+		},
+	}
+	return receiver.transactAccounts(ctx, input, []map[string]types.AttributeValue{pk}, versions)
+}
+
+// ledgerPut returns the transaction item that appends entry to the ledger. Entries are never overwritten.
+func ledgerPut(entry model.LedgerEntry) (types.TransactWriteItem, error) {
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return types.TransactWriteItem{}, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	expr, err := expression.NewBuilder().WithCondition(expression.Name("SK").AttributeNotExists()).Build()
+	if err != nil {
+		return types.TransactWriteItem{}, err
+	}
 
-	_, err = receiver.Client.UpdateItem(ctx, input)
-	return err
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			Item:                     item,
+			TableName:                aws.String(util.TableName),
+			ConditionExpression:      expr.Condition(),
+			ExpressionAttributeNames: expr.Names(),
+		},
+	}, nil
+}
+
+func (receiver AccountDB) Deposit(ctx context.Context, account model.Account, amount model.Money) error {
+	return receiver.depositWithdraw(ctx, account, amount, true)
+}
+
+func (receiver AccountDB) Withdraw(ctx context.Context, account model.Account, amount model.Money) error {
+	return receiver.depositWithdraw(ctx, account, amount, false)
+}
+
+func (receiver AccountDB) Transfer(ctx context.Context, sender, recipient model.Account, amount model.Money) error {
+	senderKey, err := attributevalue.MarshalMap(map[string]string{
+		"PK": util.GetPK(sender.PK),
+		"SK": util.GetSK(sender.SK),
+	})
+	if err != nil {
+		return err
+	}
+
+	recipientKey, err := attributevalue.MarshalMap(map[string]string{
+		"PK": util.GetPK(recipient.PK),
+		"SK": util.GetSK(recipient.SK),
+	})
+	if err != nil {
+		return err
+	}
+
+	if util.GetPK(sender.PK) == util.GetPK(recipient.PK) && util.GetSK(sender.SK) == util.GetSK(recipient.SK) {
+		return util.SameAccount
+	}
+
+	acc, err := receiver.GetAccount(ctx, sender)
+	if err != nil || acc.PK == "" {
+		return util.InvalidAccount
+	}
+
+	if sender.CheckVersion && acc.Version != sender.Version {
+		return util.VersionMismatch
+	}
+
+	if acc.Frozen {
+		return util.FrozenAccount
+	}
+
+	if acc.CloseDate != nil && !acc.CloseDate.IsZero() {
+		return util.ClosedAccount
+	}
+
+	if acc.Amount-amount < -model.NewMoney(int64(acc.Limit)) {
+		return util.InsufficientFounds
+	}
+
+	senderCond := expression.Name("PK").AttributeExists().
+		And(expression.Name("CloseDate").AttributeNotExists()).
+		And(notFrozen()).
+		And(debitCondition(amount))
+	versions := map[int]int64{}
+	if sender.CheckVersion {
+		senderCond = senderCond.And(versionCondition(sender.Version))
+		versions[0] = sender.Version
+	}
+	senderUpd := changeAmount(-amount)
+
+	senderExpr, err := expression.NewBuilder().WithUpdate(incrementVersion(senderUpd)).WithCondition(senderCond).
+		Build()
+	if err != nil {
+		return err
+	}
+
+	recipientCond := expression.Name("PK").AttributeExists().
+		And(expression.Name("CloseDate").AttributeNotExists()).
+		And(notFrozen()).
+		And(creditCondition())
+	recipientUpd := changeAmount(amount)
+
+	recipientExpr, err := expression.NewBuilder().WithUpdate(incrementVersion(recipientUpd)).
+		WithCondition(recipientCond).Build()
+	if err != nil {
+		return err
+	}
+
+	senderPut, err := ledgerPut(model.NewLedgerEntry(acc, model.LedgerTransferOut, -amount, recipient.SK))
+	if err != nil {
+		return err
+	}
+
+	recipientPut, err := ledgerPut(model.NewLedgerEntry(recipient, model.LedgerTransferIn, amount, sender.SK))
+	if err != nil {
+		return err
+	}
+
+	withdrawnPut, err := outboxPut(ctx, model.NewAccountWithdrawn(acc, amount, recipient.SK))
+	if err != nil {
+		return err
+	}
+
+	depositedPut, err := outboxPut(ctx, model.NewAccountDeposited(recipient, amount, sender.SK))
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					Key:                                 senderKey,
+					TableName:                           aws.String(util.TableName),
+					ConditionExpression:                 senderExpr.Condition(),
+					ExpressionAttributeNames:            senderExpr.Names(),
+					ExpressionAttributeValues:           senderExpr.Values(),
+					UpdateExpression:                    senderExpr.Update(),
+					ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+				},
+			},
+			{
+				Update: &types.Update{
+					Key:                                 recipientKey,
+					TableName:                           aws.String(util.TableName),
+					ConditionExpression:                 recipientExpr.Condition(),
+					ExpressionAttributeNames:            recipientExpr.Names(),
+					ExpressionAttributeValues:           recipientExpr.Values(),
+					UpdateExpression:                    recipientExpr.Update(),
+					ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+				},
+			},
+			senderPut,
+			recipientPut,
+			withdrawnPut,
+			depositedPut,
+		},
+	}
+	return receiver.transactAccounts(ctx, input, []map[string]types.AttributeValue{senderKey, recipientKey}, versions)
 }
 
-func (receiver AccountDB) Deposit(account model.Account, amount float64) error {
-	return receiver.depositWithdraw(account, amount, true)
+// errNoAvailable is returned for an account that doesn't have the Available attribute yet.
+var errNoAvailable = errors.New("account has no Available attribute")
+
+// transactAccounts writes input, whose first items update the accounts with keys, in that order. If an account
+// doesn't have the Available attribute yet, it is added to every account and the write is tried once more.
+func (receiver AccountDB) transactAccounts(ctx context.Context, input *dynamodb.TransactWriteItemsInput,
+	keys []map[string]types.AttributeValue, versions map[int]int64) error {
+
+	for attempt := 0; ; attempt++ {
+		writeCtx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+		_, err := receiver.Client.TransactWriteItems(writeCtx, input)
+		cancel()
+
+		err = cancellationError(err, len(keys), versions)
+		if !errors.Is(err, errNoAvailable) || attempt > 0 {
+			return err
+		}
+		for _, key := range keys {
+			if err := receiver.addAvailable(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
 }
 
-func (receiver AccountDB) Withdraw(account model.Account, amount float64) error {
-	return receiver.depositWithdraw(account, amount, false)
+// cancellationError maps a cancelled transaction back to the account error that caused it. The first accounts
+// transaction items update accounts; a failed condition of any later item, such as a ledger or outbox entry that
+// already exists, is not an account error and err is returned as is. versions holds the account version each
+// transaction item was conditioned on, by item index. Only debits are conditioned on the balance, so any other
+// failed account condition on an open account means insufficient funds.
+func cancellationError(err error, accounts int, versions map[int]int64) error {
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) {
+		return err
+	}
+
+	for i, reason := range canceled.CancellationReasons {
+		if aws.ToString(reason.Code) != "ConditionalCheckFailed" {
+			continue
+		}
+
+		if i >= accounts {
+			return err
+		}
+		if len(reason.Item) == 0 {
+			return util.InvalidAccount
+		}
+
+		var acc model.Account
+		if er := attributevalue.UnmarshalMap(reason.Item, &acc); er != nil {
+			return err
+		}
+		if acc.Frozen {
+			return util.FrozenAccount
+		}
+		if acc.CloseDate != nil && !acc.CloseDate.IsZero() {
+			return util.ClosedAccount
+		}
+		if version, ok := versions[i]; ok && acc.Version != version {
+			return util.VersionMismatch
+		}
+		if _, ok := reason.Item["Available"]; !ok {
+			return errNoAvailable
+		}
+		return util.InsufficientFounds
+	}
+	return err
 }
 
-func (receiver AccountDB) Close(account model.Account) error {
+func (receiver AccountDB) Close(ctx context.Context, account model.Account) error {
 	primaryKey := map[string]string{
 		"PK": util.GetPK(account.PK),
 		"SK": util.GetSK(account.SK),
@@ -225,41 +606,103 @@ func (receiver AccountDB) Close(account model.Account) error {
 		return err
 	}
 
-	acc, err := receiver.GetAccount(account)
+	acc, err := receiver.GetAccount(ctx, account)
 	if err != nil || acc.PK == "" {
-		return errors.New("invalid account")
+		return util.InvalidAccount
+	}
+
+	if account.CheckVersion && acc.Version != account.Version {
+		return util.VersionMismatch
+	}
+
+	if acc.Frozen {
+		return util.FrozenAccount
 	}
 
 	if acc.CloseDate != nil && !acc.CloseDate.IsZero() {
-		return errors.New("account is already closed")
+		return util.AlreadyClosed
 	}
 
 	upd := expression.Set(expression.Name("CloseDate"), expression.Value(time.Now().Unix()))
-	cond := expression.Name("CloseDate").AttributeNotExists()
-	cond2 := expression.Name("PK").Equal(expression.Value(util.GetPK(account.PK)))
+	cond := expression.Name("PK").AttributeExists().And(expression.Name("CloseDate").AttributeNotExists()).
+		And(notFrozen())
+	if account.CheckVersion {
+		cond = cond.And(versionCondition(account.Version))
+	}
 
-	expr, err := expression.NewBuilder().WithUpdate(upd).WithCondition(cond).WithCondition(cond2).Build()
+	expr, err := expression.NewBuilder().WithUpdate(incrementVersion(upd)).WithCondition(cond).Build()
 	if err != nil {
 		return err
 	}
 
-	input := &dynamodb.UpdateItemInput{
-		Key:                       pk,
-		TableName:                 aws.String(util.TableName),
-		ConditionExpression:       expr.Condition(),
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		UpdateExpression:          expr.Update(),
+	eventPut, err := outboxPut(ctx, model.NewAccountClosed(acc))
+	if err != nil {
+		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	countUpdate, err := openCountUpdate(acc.Type, -1)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					Key:                                 pk,
+					TableName:                           aws.String(util.TableName),
+					ConditionExpression:                 expr.Condition(),
+					ExpressionAttributeNames:            expr.Names(),
+					ExpressionAttributeValues:           expr.Values(),
+					UpdateExpression:                    expr.Update(),
+					ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+				},
+			},
+			eventPut,
+			countUpdate,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
 	defer cancel()
 
-	_, err = receiver.Client.UpdateItem(ctx, input)
+	_, err = receiver.Client.TransactWriteItems(ctx, input)
+	if acc, ok := conditionFailure(err); ok {
+		switch {
+		case acc.PK == "":
+			return util.InvalidAccount
+		case acc.Frozen:
+			return util.FrozenAccount
+		case acc.CloseDate != nil:
+			return util.AlreadyClosed
+		default:
+			return util.VersionMismatch
+		}
+	}
 	return err
 }
 
-func (receiver AccountDB) Delete(account model.Account) error {
+// conditionFailure returns the stored account if err is a transaction that failed on the account condition. The
+// account is empty when the item no longer exists.
+func conditionFailure(err error) (model.Account, bool) {
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) || len(canceled.CancellationReasons) == 0 {
+		return model.Account{}, false
+	}
+
+	reason := canceled.CancellationReasons[0]
+	if aws.ToString(reason.Code) != "ConditionalCheckFailed" {
+		return model.Account{}, false
+	}
+
+	var acc model.Account
+	if len(reason.Item) != 0 {
+		_ = attributevalue.UnmarshalMap(reason.Item, &acc)
+	}
+	return acc, true
+}
+
+func (receiver AccountDB) Delete(ctx context.Context, account model.Account) error {
 	primaryKey := map[string]string{
 		"PK": util.GetPK(account.PK),
 		"SK": util.GetSK(account.SK),
@@ -270,32 +713,115 @@ func (receiver AccountDB) Delete(account model.Account) error {
 		return err
 	}
 
-	acc, err := receiver.GetAccount(account)
+	acc, err := receiver.GetAccount(ctx, account)
 	if err != nil || acc.PK == "" {
 		return util.InvalidAccount
 	}
 
+	if account.CheckVersion && acc.Version != account.Version {
+		return util.VersionMismatch
+	}
+
+	if acc.Frozen {
+		return util.FrozenAccount
+	}
+
 	if acc.CloseDate == nil {
 		return util.OpenAccount
 	}
 
-	cond := expression.Name("CloseDate").AttributeExists()
+	cond := expression.Name("CloseDate").AttributeExists().And(notFrozen())
+	if account.CheckVersion {
+		cond = cond.And(versionCondition(account.Version))
+	}
+
 	expr, err := expression.NewBuilder().WithCondition(cond).Build()
 	if err != nil {
 		return err
 	}
 
-	input := &dynamodb.DeleteItemInput{
-		Key:                       pk,
+	eventPut, err := outboxPut(ctx, model.NewAccountDeleted(acc))
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Delete: &types.Delete{
+					Key:                                 pk,
+					TableName:                           aws.String(util.TableName),
+					ConditionExpression:                 expr.Condition(),
+					ExpressionAttributeNames:            expr.Names(),
+					ExpressionAttributeValues:           expr.Values(),
+					ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+				},
+			},
+			eventPut,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	_, err = receiver.Client.TransactWriteItems(ctx, input)
+	if acc, ok := conditionFailure(err); ok {
+		if acc.PK == "" {
+			return util.InvalidAccount
+		}
+		if acc.Frozen {
+			return util.FrozenAccount
+		}
+		return util.VersionMismatch
+	}
+	return err
+}
+
+func (receiver AccountDB) GetLedger(ctx context.Context, account model.Account, limit int32,
+	cursor string) ([]model.LedgerEntry, string, error) {
+
+	pk := util.GetPK(account.PK)
+	prefix := "LEDGER#" + strings.TrimPrefix(util.GetSK(account.SK), "ACCOUNT#") + "#"
+
+	position, err := decodeCursor(receiver.CursorSecret, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if position != nil && (position["PK"] != pk || !strings.HasPrefix(position["SK"], prefix)) {
+		return nil, "", util.InvalidCursor
+	}
+
+	keyCond := expression.KeyAnd(
+		expression.Key("PK").Equal(expression.Value(pk)),
+		expression.Key("SK").BeginsWith(prefix),
+	)
+
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, "", err
+	}
+
+	input := &dynamodb.QueryInput{
 		TableName:                 aws.String(util.TableName),
-		ConditionExpression:       expr.Condition(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExclusiveStartKey:         positionToKey(position),
+		Limit:                     aws.Int32(limit),
+		ScanIndexForward:          aws.Bool(false),
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
 	defer cancel()
 
-	_, err = receiver.Client.DeleteItem(ctx, input)
-	return err
+	result, err := receiver.Client.Query(ctx, input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var entries []model.LedgerEntry
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &entries); err != nil {
+		return nil, "", err
+	}
+	return entries, encodeCursor(receiver.CursorSecret, keyToPosition(result.LastEvaluatedKey)), nil
 }
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"main/model"
+	"main/util"
+	"time"
+)
+
+// adminUpdate applies change to the stored account and writes the result, conditioned on the version that was read,
+// together with entry and the events of the change.
+func (receiver AccountDB) adminUpdate(ctx context.Context, account model.Account, entry model.AuditEntry,
+	change func(acc *model.Account) ([]model.Event, error)) (model.Account, error) {
+
+	before, err := receiver.GetAccount(ctx, account)
+	if err != nil {
+		return model.Account{}, err
+	}
+	if before.PK == "" {
+		return model.Account{}, util.InvalidAccount
+	}
+
+	after := before
+	events, err := change(&after)
+	if err != nil {
+		return model.Account{}, err
+	}
+	after.Version++
+
+	// The version condition makes sure Amount did not change since it was read.
+	upd := expression.Set(expression.Name("Limit"), expression.Value(after.Limit)).
+		Set(expression.Name("Available"), expression.Value(available(after))).
+		Set(expression.Name("Version"), expression.Value(after.Version))
+	if after.Frozen {
+		upd = upd.Set(expression.Name("Frozen"), expression.Value(true))
+	} else {
+		upd = upd.Remove(expression.Name("Frozen"))
+	}
+	if after.CloseDate != nil {
+		upd = upd.Set(expression.Name("CloseDate"), expression.Value(after.CloseDate.Unix()))
+	}
+
+	expr, err := expression.NewBuilder().WithUpdate(upd).WithCondition(versionCondition(before.Version)).Build()
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	pk, err := attributevalue.MarshalMap(map[string]string{"PK": before.PK, "SK": before.SK})
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	update := types.TransactWriteItem{
+		Update: &types.Update{
+			Key:                       pk,
+			TableName:                 aws.String(util.TableName),
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			UpdateExpression:          expr.Update(),
+		},
+	}
+
+	// rest holds the events of the change and, if it closes the account, the open account counter.
+	var rest []types.TransactWriteItem
+	for _, event := range events {
+		eventPut, err := outboxPut(ctx, event)
+		if err != nil {
+			return model.Account{}, err
+		}
+		rest = append(rest, eventPut)
+	}
+	if before.CloseDate == nil && after.CloseDate != nil {
+		countUpdate, err := openCountUpdate(after.Type, -1)
+		if err != nil {
+			return model.Account{}, err
+		}
+		rest = append(rest, countUpdate)
+	}
+
+	entry.Before, entry.After = &before, &after
+	for attempt := 0; attempt < maxAuditAttempts; attempt++ {
+		head, err := receiver.auditHead(ctx, entry)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		entryPut, err := auditPut(entry.Chain(head, receiver.AuditSecret))
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		items := append([]types.TransactWriteItem{update, entryPut}, rest...)
+
+		ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+		_, err = receiver.Client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+		cancel()
+		if _, ok := conditionFailure(err); ok {
+			return model.Account{}, util.VersionMismatch
+		}
+		if auditConflict(err, 1) {
+			continue
+		}
+		if err != nil {
+			return model.Account{}, err
+		}
+		return after, nil
+	}
+	return model.Account{}, util.AuditConflict
+}
+
+func (receiver AccountDB) Freeze(ctx context.Context, account model.Account, frozen bool,
+	entry model.AuditEntry) (model.Account, error) {
+
+	return receiver.adminUpdate(ctx, account, entry, func(acc *model.Account) ([]model.Event, error) {
+		return nil, freeze(acc, frozen)
+	})
+}
+
+func (receiver AccountDB) SetLimit(ctx context.Context, account model.Account, limit int,
+	entry model.AuditEntry) (model.Account, error) {
+
+	return receiver.adminUpdate(ctx, account, entry, func(acc *model.Account) ([]model.Event, error) {
+		return nil, setLimit(acc, limit)
+	})
+}
+
+func (receiver AccountDB) ForceClose(ctx context.Context, account model.Account,
+	entry model.AuditEntry) (model.Account, error) {
+
+	return receiver.adminUpdate(ctx, account, entry, func(acc *model.Account) ([]model.Event, error) {
+		return forceClose(acc)
+	})
+}
+
+// The changes below are shared by every backend. They check that the change is allowed and apply it to acc.
+
+func freeze(acc *model.Account, frozen bool) error {
+	switch {
+	case isClosed(*acc):
+		return util.ClosedAccount
+	case frozen && acc.Frozen:
+		return util.AlreadyFrozen
+	case !frozen && !acc.Frozen:
+		return util.NotFrozen
+	}
+	acc.Frozen = frozen
+	return nil
+}
+
+func setLimit(acc *model.Account, limit int) error {
+	if isClosed(*acc) {
+		return util.ClosedAccount
+	}
+	acc.Limit = limit
+	return nil
+}
+
+func forceClose(acc *model.Account) ([]model.Event, error) {
+	if isClosed(*acc) {
+		return nil, util.AlreadyClosed
+	}
+
+	// DynamoDB stores the close date in seconds, so drop the sub-second part to match.
+	now := time.Unix(time.Now().Unix(), 0)
+	acc.CloseDate = &now
+	// A closed account cannot be unfrozen, so unfreeze it here or it could never be deleted.
+	acc.Frozen = false
+	return []model.Event{model.NewAccountClosed(*acc)}, nil
+}
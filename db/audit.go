@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"main/model"
+	"main/util"
+)
+
+// maxAuditAttempts bounds how often an entry is chained again after a concurrent entry took its place in the chain.
+const maxAuditAttempts = 5
+
+// auditPut returns the transaction item that appends entry to its chain. It fails if the chain has grown since entry
+// was chained, so two entries can never follow the same one.
+func auditPut(entry model.AuditEntry) (types.TransactWriteItem, error) {
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return types.TransactWriteItem{}, err
+	}
+
+	expr, err := expression.NewBuilder().WithCondition(expression.Name("SK").AttributeNotExists()).Build()
+	if err != nil {
+		return types.TransactWriteItem{}, err
+	}
+
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			Item:                     item,
+			TableName:                aws.String(util.TableName),
+			ConditionExpression:      expr.Condition(),
+			ExpressionAttributeNames: expr.Names(),
+		},
+	}, nil
+}
+
+// auditConflict reports whether err is a transaction that failed because the audit entry at index was taken.
+func auditConflict(err error, index int) bool {
+	var canceled *types.TransactionCanceledException
+	return errors.As(err, &canceled) && len(canceled.CancellationReasons) > index &&
+		aws.ToString(canceled.CancellationReasons[index].Code) == "ConditionalCheckFailed"
+}
+
+func auditQuery(userID, accountID string) (*dynamodb.QueryInput, error) {
+	keyCond := expression.KeyAnd(
+		expression.Key("PK").Equal(expression.Value(util.GetPK(userID))),
+		expression.Key("SK").BeginsWith(model.AuditPrefix(accountID)),
+	)
+
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.QueryInput{
+		TableName:                 aws.String(util.TableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ConsistentRead:            aws.Bool(true),
+	}, nil
+}
+
+// auditHead returns the last entry of the chain entry belongs to, or nil if the chain is empty.
+func (receiver AccountDB) auditHead(ctx context.Context, entry model.AuditEntry) (*model.AuditEntry, error) {
+	input, err := auditQuery(entry.UserID, entry.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	input.ScanIndexForward = aws.Bool(false)
+	input.Limit = aws.Int32(1)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	output, err := receiver.Client.Query(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Items) == 0 {
+		return nil, nil
+	}
+
+	var head model.AuditEntry
+	if err := attributevalue.UnmarshalMap(output.Items[0], &head); err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
+
+func (receiver AccountDB) Audit(ctx context.Context, entry model.AuditEntry) error {
+	for attempt := 0; attempt < maxAuditAttempts; attempt++ {
+		head, err := receiver.auditHead(ctx, entry)
+		if err != nil {
+			return err
+		}
+
+		entryPut, err := auditPut(entry.Chain(head, receiver.AuditSecret))
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+		_, err = receiver.Client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: []types.TransactWriteItem{entryPut},
+		})
+		cancel()
+		if !auditConflict(err, 0) {
+			return err
+		}
+	}
+	return util.AuditConflict
+}
+
+func (receiver AccountDB) AuditTrail(ctx context.Context, userID, accountID string) ([]model.AuditEntry, error) {
+	input, err := auditQuery(userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []model.AuditEntry
+	paginator := dynamodb.NewQueryPaginator(receiver.Client, input)
+	for paginator.HasMorePages() {
+		ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		var items []model.AuditEntry
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, err
+		}
+		entries = append(entries, items...)
+	}
+	return entries, nil
+}
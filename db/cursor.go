@@ -0,0 +1,77 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"main/util"
+	"strings"
+)
+
+func signCursor(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// encodeCursor turns the position after the last returned item into an opaque continuation token. The token is
+// signed, so clients can't point it at keys they did not get from us.
+func encodeCursor(secret []byte, position map[string]string) string {
+	if len(position) == 0 {
+		return ""
+	}
+
+	data, err := json.Marshal(position)
+	if err != nil {
+		return ""
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + signCursor(secret, payload)
+}
+
+func decodeCursor(secret []byte, cursor string) (map[string]string, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	payload, signature, ok := strings.Cut(cursor, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(signCursor(secret, payload))) {
+		return nil, util.InvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, util.InvalidCursor
+	}
+
+	var position map[string]string
+	if err := json.Unmarshal(data, &position); err != nil {
+		return nil, util.InvalidCursor
+	}
+	return position, nil
+}
+
+func keyToPosition(key map[string]types.AttributeValue) map[string]string {
+	position := make(map[string]string, len(key))
+	for k, v := range key {
+		if s, ok := v.(*types.AttributeValueMemberS); ok {
+			position[k] = s.Value
+		}
+	}
+	return position
+}
+
+func positionToKey(position map[string]string) map[string]types.AttributeValue {
+	if len(position) == 0 {
+		return nil
+	}
+
+	key := make(map[string]types.AttributeValue, len(position))
+	for k, v := range position {
+		key[k] = &types.AttributeValueMemberS{Value: v}
+	}
+	return key
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"main/model"
+	"main/util"
+	"time"
+)
+
+func (receiver AccountDB) ReserveIdempotency(ctx context.Context,
+	record model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return model.IdempotencyRecord{}, false, err
+	}
+
+	cond := expression.Name("PK").AttributeNotExists().
+		Or(expression.Name("ExpiresAt").LessThan(expression.Value(time.Now().Unix())))
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return model.IdempotencyRecord{}, false, err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:                                item,
+		TableName:                           aws.String(util.TableName),
+		ConditionExpression:                 expr.Condition(),
+		ExpressionAttributeNames:            expr.Names(),
+		ExpressionAttributeValues:           expr.Values(),
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	_, err = receiver.Client.PutItem(ctx, input)
+	if err == nil {
+		return record, true, nil
+	}
+
+	var ccf *types.ConditionalCheckFailedException
+	if !errors.As(err, &ccf) {
+		return model.IdempotencyRecord{}, false, err
+	}
+
+	existing := ccf.Item
+	if len(existing) == 0 {
+		result, err := receiver.Client.GetItem(ctx, &dynamodb.GetItemInput{
+			Key:            map[string]types.AttributeValue{"PK": item["PK"], "SK": item["SK"]},
+			TableName:      aws.String(util.TableName),
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return model.IdempotencyRecord{}, false, err
+		}
+		existing = result.Item
+	}
+
+	var stored model.IdempotencyRecord
+	if err := attributevalue.UnmarshalMap(existing, &stored); err != nil {
+		return model.IdempotencyRecord{}, false, err
+	}
+	return stored, false, nil
+}
+
+func (receiver AccountDB) SaveIdempotency(ctx context.Context, record model.IdempotencyRecord) error {
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	_, err = receiver.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(util.TableName),
+	})
+	return err
+}
+
+func (receiver AccountDB) DeleteIdempotency(ctx context.Context, record model.IdempotencyRecord) error {
+	pk, err := attributevalue.MarshalMap(map[string]string{
+		"PK": record.PK,
+		"SK": record.SK,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	_, err = receiver.Client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		Key:       pk,
+		TableName: aws.String(util.TableName),
+	})
+	return err
+}
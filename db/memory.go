@@ -0,0 +1,491 @@
+package db
+
+import (
+	"context"
+	"main/model"
+	"main/util"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryDB keeps accounts in memory. It follows the same rules as AccountDB and is meant for tests and for
+// running the service without DynamoDB. The zero value is ready to use.
+type MemoryDB struct {
+	// CursorSecret signs the continuation tokens of paged results.
+	CursorSecret []byte
+	// AuditSecret keys the hashes of the audit log.
+	AuditSecret []byte
+
+	mu       sync.RWMutex
+	accounts map[string]map[string]model.Account
+	ledger   map[string][]model.LedgerEntry
+	requests map[string]model.IdempotencyRecord
+	outbox   []model.Event
+	audit    []model.AuditEntry
+}
+
+func (receiver *MemoryDB) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (receiver *MemoryDB) get(account model.Account) (model.Account, bool) {
+	acc, ok := receiver.accounts[util.GetPK(account.PK)][util.GetSK(account.SK)]
+	return acc, ok
+}
+
+func (receiver *MemoryDB) put(account model.Account) {
+	if receiver.accounts == nil {
+		receiver.accounts = make(map[string]map[string]model.Account)
+	}
+
+	pk := util.GetPK(account.PK)
+	if receiver.accounts[pk] == nil {
+		receiver.accounts[pk] = make(map[string]model.Account)
+	}
+	receiver.accounts[pk][util.GetSK(account.SK)] = account
+}
+
+func ledgerKey(account model.Account) string {
+	return util.GetPK(account.PK) + "|" + util.GetSK(account.SK)
+}
+
+func (receiver *MemoryDB) record(account model.Account, entryType string, amount model.Money, counterparty string) {
+	if receiver.ledger == nil {
+		receiver.ledger = make(map[string][]model.LedgerEntry)
+	}
+
+	key := ledgerKey(account)
+	receiver.ledger[key] = append(receiver.ledger[key], model.NewLedgerEntry(account, entryType, amount, counterparty))
+}
+
+func isClosed(account model.Account) bool {
+	return account.CloseDate != nil && !account.CloseDate.IsZero()
+}
+
+func (receiver *MemoryDB) Create(ctx context.Context, account model.Account) error {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	for _, acc := range receiver.accounts[util.GetPK(account.PK)] {
+		if acc.Type == account.Type {
+			return util.AlreadyExists
+		}
+	}
+
+	account.PK = util.GetPK(account.PK)
+	account.SK = util.GetSK(account.SK)
+	account.Transactions = nil
+	receiver.put(account)
+	receiver.outbox = append(receiver.outbox, withCorrelation(ctx, model.NewAccountOpened(account)))
+	return nil
+}
+
+func (receiver *MemoryDB) GetAll(ctx context.Context, id, t string) ([]model.Account, error) {
+	receiver.mu.RLock()
+	defer receiver.mu.RUnlock()
+
+	var accounts []model.Account
+	for _, acc := range receiver.accounts[util.GetPK(id)] {
+		if (t == "open" && isClosed(acc)) || (t == "closed" && !isClosed(acc)) {
+			continue
+		}
+		accounts = append(accounts, acc)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return strings.Compare(accounts[i].SK, accounts[j].SK) < 0
+	})
+	return accounts, nil
+}
+
+func (receiver *MemoryDB) GetAllPage(ctx context.Context, id, t string, limit int32,
+	cursor string) ([]model.Account, string, error) {
+
+	position, err := decodeCursor(receiver.CursorSecret, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if position != nil && position["PK"] != util.GetPK(id) {
+		return nil, "", util.InvalidCursor
+	}
+
+	all, err := receiver.GetAll(ctx, id, t)
+	if err != nil {
+		return nil, "", err
+	}
+
+	start := 0
+	if position != nil {
+		start = sort.Search(len(all), func(i int) bool {
+			return all[i].SK > position["SK"]
+		})
+	}
+
+	end := start + int(limit)
+	if end >= len(all) {
+		return all[start:], "", nil
+	}
+
+	last := all[end-1]
+	return all[start:end], encodeCursor(receiver.CursorSecret, map[string]string{"PK": last.PK, "SK": last.SK}), nil
+}
+
+func (receiver *MemoryDB) GetAccount(ctx context.Context, account model.Account) (model.Account, error) {
+	receiver.mu.RLock()
+	defer receiver.mu.RUnlock()
+
+	acc, _ := receiver.get(account)
+	return acc, nil
+}
+
+func (receiver *MemoryDB) depositWithdraw(ctx context.Context, account model.Account, amount model.Money,
+	deposit bool) error {
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	acc, ok := receiver.get(account)
+	if !ok {
+		return util.InvalidAccount
+	}
+
+	if account.CheckVersion && acc.Version != account.Version {
+		return util.VersionMismatch
+	}
+
+	if acc.Frozen {
+		return util.FrozenAccount
+	}
+
+	if isClosed(acc) {
+		return util.ClosedAccount
+	}
+
+	if deposit {
+		acc.Amount += amount
+		receiver.record(acc, model.LedgerDeposit, amount, "")
+		receiver.outbox = append(receiver.outbox, withCorrelation(ctx, model.NewAccountDeposited(acc, amount, "")))
+	} else {
+		if acc.Amount-amount < -model.NewMoney(int64(acc.Limit)) {
+			return util.InsufficientFounds
+		}
+		acc.Amount -= amount
+		receiver.record(acc, model.LedgerWithdrawal, -amount, "")
+		receiver.outbox = append(receiver.outbox, withCorrelation(ctx, model.NewAccountWithdrawn(acc, amount, "")))
+	}
+	acc.Version++
+	receiver.put(acc)
+	return nil
+}
+
+func (receiver *MemoryDB) Deposit(ctx context.Context, account model.Account, amount model.Money) error {
+	return receiver.depositWithdraw(ctx, account, amount, true)
+}
+
+func (receiver *MemoryDB) Withdraw(ctx context.Context, account model.Account, amount model.Money) error {
+	return receiver.depositWithdraw(ctx, account, amount, false)
+}
+
+func (receiver *MemoryDB) Transfer(ctx context.Context, sender, recipient model.Account, amount model.Money) error {
+	if util.GetPK(sender.PK) == util.GetPK(recipient.PK) && util.GetSK(sender.SK) == util.GetSK(recipient.SK) {
+		return util.SameAccount
+	}
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	from, ok := receiver.get(sender)
+	if !ok {
+		return util.InvalidAccount
+	}
+	if sender.CheckVersion && from.Version != sender.Version {
+		return util.VersionMismatch
+	}
+	if from.Frozen {
+		return util.FrozenAccount
+	}
+	if isClosed(from) {
+		return util.ClosedAccount
+	}
+	if from.Amount-amount < -model.NewMoney(int64(from.Limit)) {
+		return util.InsufficientFounds
+	}
+
+	to, ok := receiver.get(recipient)
+	if !ok {
+		return util.InvalidAccount
+	}
+	if to.Frozen {
+		return util.FrozenAccount
+	}
+	if isClosed(to) {
+		return util.ClosedAccount
+	}
+
+	from.Amount -= amount
+	from.Version++
+	to.Amount += amount
+	to.Version++
+	receiver.put(from)
+	receiver.put(to)
+	receiver.record(from, model.LedgerTransferOut, -amount, to.SK)
+	receiver.record(to, model.LedgerTransferIn, amount, from.SK)
+	receiver.outbox = append(receiver.outbox, withCorrelation(ctx, model.NewAccountWithdrawn(from, amount, to.SK)),
+		withCorrelation(ctx, model.NewAccountDeposited(to, amount, from.SK)))
+	return nil
+}
+
+func (receiver *MemoryDB) Close(ctx context.Context, account model.Account) error {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	acc, ok := receiver.get(account)
+	if !ok {
+		return util.InvalidAccount
+	}
+
+	if account.CheckVersion && acc.Version != account.Version {
+		return util.VersionMismatch
+	}
+
+	if acc.Frozen {
+		return util.FrozenAccount
+	}
+
+	if isClosed(acc) {
+		return util.AlreadyClosed
+	}
+
+	// DynamoDB stores the close date in seconds, so drop the sub-second part to match.
+	now := time.Unix(time.Now().Unix(), 0)
+	acc.CloseDate = &now
+	acc.Version++
+	receiver.put(acc)
+	receiver.outbox = append(receiver.outbox, withCorrelation(ctx, model.NewAccountClosed(acc)))
+	return nil
+}
+
+func (receiver *MemoryDB) Delete(ctx context.Context, account model.Account) error {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	acc, ok := receiver.get(account)
+	if !ok {
+		return util.InvalidAccount
+	}
+
+	if account.CheckVersion && acc.Version != account.Version {
+		return util.VersionMismatch
+	}
+
+	if acc.Frozen {
+		return util.FrozenAccount
+	}
+
+	if acc.CloseDate == nil {
+		return util.OpenAccount
+	}
+
+	delete(receiver.accounts[util.GetPK(account.PK)], util.GetSK(account.SK))
+	receiver.outbox = append(receiver.outbox, withCorrelation(ctx, model.NewAccountDeleted(acc)))
+	return nil
+}
+
+func (receiver *MemoryDB) GetLedger(ctx context.Context, account model.Account, limit int32,
+	cursor string) ([]model.LedgerEntry, string, error) {
+
+	position, err := decodeCursor(receiver.CursorSecret, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if position != nil && position["PK"] != util.GetPK(account.PK) {
+		return nil, "", util.InvalidCursor
+	}
+
+	receiver.mu.RLock()
+	defer receiver.mu.RUnlock()
+
+	all := receiver.ledger[ledgerKey(account)]
+
+	var entries []model.LedgerEntry
+	for i := len(all) - 1; i >= 0 && len(entries) < int(limit); i-- {
+		if position != nil && all[i].SK >= position["SK"] {
+			continue
+		}
+		entries = append(entries, all[i])
+	}
+
+	if len(entries) == 0 || entries[len(entries)-1].SK == all[0].SK {
+		return entries, "", nil
+	}
+
+	last := entries[len(entries)-1]
+	return entries, encodeCursor(receiver.CursorSecret, map[string]string{"PK": last.PK, "SK": last.SK}), nil
+}
+
+func (receiver *MemoryDB) ReserveIdempotency(ctx context.Context,
+	record model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	if receiver.requests == nil {
+		receiver.requests = make(map[string]model.IdempotencyRecord)
+	}
+
+	key := record.PK + "|" + record.SK
+	if stored, ok := receiver.requests[key]; ok && stored.ExpiresAt >= time.Now().Unix() {
+		return stored, false, nil
+	}
+	receiver.requests[key] = record
+	return record, true, nil
+}
+
+func (receiver *MemoryDB) SaveIdempotency(ctx context.Context, record model.IdempotencyRecord) error {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	if receiver.requests == nil {
+		receiver.requests = make(map[string]model.IdempotencyRecord)
+	}
+	receiver.requests[record.PK+"|"+record.SK] = record
+	return nil
+}
+
+func (receiver *MemoryDB) DeleteIdempotency(ctx context.Context, record model.IdempotencyRecord) error {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	delete(receiver.requests, record.PK+"|"+record.SK)
+	return nil
+}
+
+func (receiver *MemoryDB) PendingEvents(ctx context.Context, limit int32) ([]model.Event, error) {
+	receiver.mu.RLock()
+	defer receiver.mu.RUnlock()
+
+	n := min(int(limit), len(receiver.outbox))
+	return append([]model.Event(nil), receiver.outbox[:n]...), nil
+}
+
+func (receiver *MemoryDB) MarkEventSent(ctx context.Context, event model.Event) error {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	for i, pending := range receiver.outbox {
+		if pending.ID == event.ID {
+			receiver.outbox = append(receiver.outbox[:i], receiver.outbox[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (receiver *MemoryDB) CountPendingEvents(ctx context.Context) (int64, error) {
+	receiver.mu.RLock()
+	defer receiver.mu.RUnlock()
+
+	return int64(len(receiver.outbox)), nil
+}
+
+func (receiver *MemoryDB) CountOpenAccounts(ctx context.Context) (map[string]int64, error) {
+	receiver.mu.RLock()
+	defer receiver.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, accounts := range receiver.accounts {
+		for _, acc := range accounts {
+			if !isClosed(acc) {
+				counts[acc.Type]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+// appendAudit chains entry to the last entry of its account. The caller must hold the lock.
+func (receiver *MemoryDB) appendAudit(entry model.AuditEntry) {
+	var prev *model.AuditEntry
+	for i := len(receiver.audit) - 1; i >= 0; i-- {
+		if receiver.audit[i].PK == entry.PK && receiver.audit[i].AccountID == entry.AccountID {
+			prev = &receiver.audit[i]
+			break
+		}
+	}
+	receiver.audit = append(receiver.audit, entry.Chain(prev, receiver.AuditSecret))
+}
+
+func (receiver *MemoryDB) Audit(ctx context.Context, entry model.AuditEntry) error {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	receiver.appendAudit(entry)
+	return nil
+}
+
+func (receiver *MemoryDB) AuditTrail(ctx context.Context, userID, accountID string) ([]model.AuditEntry, error) {
+	receiver.mu.RLock()
+	defer receiver.mu.RUnlock()
+
+	pk := util.GetPK(userID)
+	var entries []model.AuditEntry
+	for _, entry := range receiver.audit {
+		if entry.PK == pk && entry.AccountID == accountID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (receiver *MemoryDB) adminUpdate(ctx context.Context, account model.Account, entry model.AuditEntry,
+	change func(acc *model.Account) ([]model.Event, error)) (model.Account, error) {
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	before, ok := receiver.get(account)
+	if !ok {
+		return model.Account{}, util.InvalidAccount
+	}
+
+	after := before
+	events, err := change(&after)
+	if err != nil {
+		return model.Account{}, err
+	}
+	after.Version++
+	receiver.put(after)
+
+	entry.Before, entry.After = &before, &after
+	receiver.appendAudit(entry)
+	for _, event := range events {
+		receiver.outbox = append(receiver.outbox, withCorrelation(ctx, event))
+	}
+	return after, nil
+}
+
+func (receiver *MemoryDB) Freeze(ctx context.Context, account model.Account, frozen bool,
+	entry model.AuditEntry) (model.Account, error) {
+
+	return receiver.adminUpdate(ctx, account, entry, func(acc *model.Account) ([]model.Event, error) {
+		return nil, freeze(acc, frozen)
+	})
+}
+
+func (receiver *MemoryDB) SetLimit(ctx context.Context, account model.Account, limit int,
+	entry model.AuditEntry) (model.Account, error) {
+
+	return receiver.adminUpdate(ctx, account, entry, func(acc *model.Account) ([]model.Event, error) {
+		return nil, setLimit(acc, limit)
+	})
+}
+
+func (receiver *MemoryDB) ForceClose(ctx context.Context, account model.Account,
+	entry model.AuditEntry) (model.Account, error) {
+
+	return receiver.adminUpdate(ctx, account, entry, func(acc *model.Account) ([]model.Event, error) {
+		return forceClose(acc)
+	})
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"main/model"
+	"main/util"
+)
+
+// MigrateMoney rewrites account amounts that were stored as float64 into the canonical Money format. Items that
+// were changed concurrently are skipped and picked up by the next run. It returns the number of migrated items.
+func (receiver AccountDB) MigrateMoney() (int, error) {
+	filter := expression.Name("SK").BeginsWith("ACCOUNT#")
+	expr, err := expression.NewBuilder().WithFilter(filter).Build()
+	if err != nil {
+		return 0, err
+	}
+
+	paginator := dynamodb.NewScanPaginator(receiver.Client, &dynamodb.ScanInput{
+		TableName:                 aws.String(util.TableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+	})
+
+	migrated := 0
+	for paginator.HasMorePages() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout(receiver.Timeout))
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return migrated, err
+		}
+
+		for _, item := range page.Items {
+			amount, ok := item["Amount"].(*types.AttributeValueMemberN)
+			if !ok {
+				continue
+			}
+
+			value, normalized, err := model.NormalizeMoney(amount.Value)
+			if err != nil {
+				return migrated, err
+			}
+			if normalized {
+				continue
+			}
+
+			ok, err = receiver.migrateAmount(item["PK"], item["SK"], amount, value)
+			if err != nil {
+				return migrated, err
+			}
+			if ok {
+				migrated++
+			}
+		}
+	}
+	return migrated, nil
+}
+
+// storedValue passes an attribute value read from the table through the expression builder unchanged.
+type storedValue struct {
+	types.AttributeValue
+}
+
+func (v storedValue) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	return v.AttributeValue, nil
+}
+
+func (receiver AccountDB) migrateAmount(pk, sk types.AttributeValue, old *types.AttributeValueMemberN,
+	value model.Money) (bool, error) {
+
+	upd := expression.Set(expression.Name("Amount"), expression.Value(value))
+	cond := expression.Name("Amount").Equal(expression.Value(storedValue{old}))
+
+	expr, err := expression.NewBuilder().WithUpdate(upd).WithCondition(cond).Build()
+	if err != nil {
+		return false, err
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		Key:                       map[string]types.AttributeValue{"PK": pk, "SK": sk},
+		TableName:                 aws.String(util.TableName),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout(receiver.Timeout))
+	defer cancel()
+
+	_, err = receiver.Client.UpdateItem(ctx, input)
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// addAvailable adds the Available attribute to an account written before it existed. It does nothing if the account
+// got it or changed in the meantime.
+func (receiver AccountDB) addAvailable(ctx context.Context, key map[string]types.AttributeValue) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	result, err := receiver.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		Key:            key,
+		TableName:      aws.String(util.TableName),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || len(result.Item) == 0 {
+		return err
+	}
+
+	var acc model.Account
+	if err := attributevalue.UnmarshalMap(result.Item, &acc); err != nil {
+		return err
+	}
+
+	upd := expression.Set(expression.Name("Available"), expression.Value(available(acc)))
+	cond := expression.Name("Available").AttributeNotExists().
+		And(expression.Name("Amount").Equal(expression.Value(storedValue{result.Item["Amount"]}))).
+		And(expression.Name("Limit").Equal(expression.Value(storedValue{result.Item["Limit"]})))
+
+	expr, err := expression.NewBuilder().WithUpdate(upd).WithCondition(cond).Build()
+	if err != nil {
+		return err
+	}
+
+	_, err = receiver.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                       key,
+		TableName:                 aws.String(util.TableName),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+	})
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS accounts
+(
+    user_id    TEXT           NOT NULL,
+    account_id UUID           NOT NULL,
+    amount     NUMERIC(20, 2) NOT NULL DEFAULT 0,
+    "limit"    INTEGER        NOT NULL,
+    type       TEXT           NOT NULL,
+    open_date  TIMESTAMPTZ    NOT NULL,
+    close_date TIMESTAMPTZ,
+    PRIMARY KEY (user_id, account_id),
+    -- A user can have only one account of each type, closed accounts included.
+    UNIQUE (user_id, type)
+);
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS ledger
+(
+    id              UUID PRIMARY KEY,
+    user_id         TEXT           NOT NULL,
+    account_id      UUID           NOT NULL,
+    type            TEXT           NOT NULL,
+    amount          NUMERIC(20, 2) NOT NULL,
+    counterparty_id UUID,
+    date            TIMESTAMPTZ    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ledger_account_date ON ledger (user_id, account_id, date DESC, id DESC);
+
+CREATE OR REPLACE FUNCTION ledger_immutable() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'ledger entries are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_immutable ON ledger;
+CREATE TRIGGER ledger_immutable
+    BEFORE UPDATE OR DELETE
+    ON ledger
+    FOR EACH ROW
+EXECUTE FUNCTION ledger_immutable();
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    user_id      TEXT        NOT NULL,
+    key          TEXT        NOT NULL,
+    fingerprint  TEXT        NOT NULL,
+    status       INTEGER     NOT NULL DEFAULT 0,
+    content_type TEXT        NOT NULL DEFAULT '',
+    body         BYTEA,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id          UUID PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    payload     JSONB       NOT NULL,
+    sent_at     TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (occurred_at, id) WHERE sent_at IS NULL;
@@ -0,0 +1 @@
+ALTER TABLE accounts ADD COLUMN frozen BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id             UUID PRIMARY KEY,
+    user_id        TEXT        NOT NULL,
+    account_id     UUID,
+    action         TEXT        NOT NULL,
+    actor          TEXT        NOT NULL,
+    reason         TEXT        NOT NULL,
+    correlation_id TEXT        NOT NULL DEFAULT '',
+    before         JSONB,
+    after          JSONB,
+    date           TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_account_date ON audit_log (user_id, account_id, date);
@@ -0,0 +1,31 @@
+-- Account IDs are kept as text, so an entry reads back exactly as it was hashed.
+ALTER TABLE audit_log ALTER COLUMN account_id TYPE TEXT;
+UPDATE audit_log SET account_id = '' WHERE account_id IS NULL;
+ALTER TABLE audit_log ALTER COLUMN account_id SET DEFAULT '';
+ALTER TABLE audit_log ALTER COLUMN account_id SET NOT NULL;
+ALTER TABLE audit_log ALTER COLUMN reason SET DEFAULT '';
+
+-- Entries written before the chain keep sequence 0 and are not part of it.
+ALTER TABLE audit_log ADD COLUMN sequence  BIGINT  NOT NULL DEFAULT 0;
+ALTER TABLE audit_log ADD COLUMN ip        TEXT    NOT NULL DEFAULT '';
+ALTER TABLE audit_log ADD COLUMN outcome   TEXT    NOT NULL DEFAULT 'success';
+ALTER TABLE audit_log ADD COLUMN status    INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE audit_log ADD COLUMN error     TEXT    NOT NULL DEFAULT '';
+ALTER TABLE audit_log ADD COLUMN prev_hash TEXT    NOT NULL DEFAULT '';
+ALTER TABLE audit_log ADD COLUMN hash      TEXT    NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS audit_log_chain ON audit_log (user_id, account_id, sequence) WHERE sequence > 0;
+
+CREATE OR REPLACE FUNCTION audit_log_immutable() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit log entries are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_immutable ON audit_log;
+CREATE TRIGGER audit_log_immutable
+    BEFORE UPDATE OR DELETE
+    ON audit_log
+    FOR EACH ROW
+EXECUTE FUNCTION audit_log_immutable();
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"hash/fnv"
+	"main/model"
+	"main/util"
+	"sort"
+	"strconv"
+)
+
+// outboxShards is the number of partitions the outbox is spread over, so writes don't all land on one hot partition.
+// The events of one account always go to the same shard and stay in order.
+const outboxShards = 16
+
+// outboxPK returns the partition of shard, e.g. 'OUTBOX#3'.
+func outboxPK(shard int) string {
+	return "OUTBOX#" + strconv.Itoa(shard)
+}
+
+func outboxShard(event model.Event) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(event.AccountID))
+	return int(hash.Sum32() % outboxShards)
+}
+
+// outboxTimeFormat is fixed width, so outbox sort keys sort in time order.
+const outboxTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+type outboxItem struct {
+	PK    string      `dynamodbav:"PK"`
+	SK    string      `dynamodbav:"SK"`
+	Event model.Event `dynamodbav:"Event"`
+}
+
+func outboxSK(event model.Event) string {
+	return "EVENT#" + event.OccurredAt.UTC().Format(outboxTimeFormat) + "#" + event.ID
+}
+
+func outboxKey(event model.Event) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: outboxPK(outboxShard(event))},
+		"SK": &types.AttributeValueMemberS{Value: outboxSK(event)},
+	}
+}
+
+// outboxPut returns the transaction item that adds event to the outbox.
+func outboxPut(ctx context.Context, event model.Event) (types.TransactWriteItem, error) {
+	event = withCorrelation(ctx, event)
+	item, err := attributevalue.MarshalMap(outboxItem{
+		PK:    outboxPK(outboxShard(event)),
+		SK:    outboxSK(event),
+		Event: event,
+	})
+	if err != nil {
+		return types.TransactWriteItem{}, err
+	}
+
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			Item:      item,
+			TableName: aws.String(util.TableName),
+		},
+	}, nil
+}
+
+// PendingEvents reads up to limit events from every shard and returns the oldest limit of them, so the result is in
+// order across shards too.
+func (receiver AccountDB) PendingEvents(ctx context.Context, limit int32) ([]model.Event, error) {
+	var items []outboxItem
+	for shard := range outboxShards {
+		shardItems, err := receiver.pendingEvents(ctx, shard, limit)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, shardItems...)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].SK < items[j].SK
+	})
+	if len(items) > int(limit) {
+		items = items[:limit]
+	}
+
+	events := make([]model.Event, len(items))
+	for i, item := range items {
+		events[i] = item.Event
+	}
+	return events, nil
+}
+
+func (receiver AccountDB) pendingEvents(ctx context.Context, shard int, limit int32) ([]outboxItem, error) {
+	keyCond := expression.Key("PK").Equal(expression.Value(outboxPK(shard)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(util.TableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		Limit:                     aws.Int32(limit),
+		ConsistentRead:            aws.Bool(true),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	result, err := receiver.Client.Query(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []outboxItem
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// MarkEventSent removes a published event from the outbox. Published events are not kept in DynamoDB, the broker
+// is their record from then on.
+func (receiver AccountDB) MarkEventSent(ctx context.Context, event model.Event) error {
+	input := &dynamodb.DeleteItemInput{
+		Key:       outboxKey(event),
+		TableName: aws.String(util.TableName),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	_, err := receiver.Client.DeleteItem(ctx, input)
+	return err
+}
+
+func (receiver AccountDB) CountPendingEvents(ctx context.Context) (int64, error) {
+	var count int64
+	for shard := range outboxShards {
+		shardCount, err := receiver.countPendingEvents(ctx, shard)
+		if err != nil {
+			return 0, err
+		}
+		count += shardCount
+	}
+	return count, nil
+}
+
+func (receiver AccountDB) countPendingEvents(ctx context.Context, shard int) (int64, error) {
+	keyCond := expression.Key("PK").Equal(expression.Value(outboxPK(shard)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return 0, err
+	}
+
+	paginator := dynamodb.NewQueryPaginator(receiver.Client, &dynamodb.QueryInput{
+		TableName:                 aws.String(util.TableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		Select:                    types.SelectCount,
+	})
+
+	var count int64
+	for paginator.HasMorePages() {
+		ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return 0, err
+		}
+		count += int64(page.Count)
+	}
+	return count, nil
+}
@@ -0,0 +1,854 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"github.com/lib/pq"
+	"main/model"
+	"main/util"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationLock is the advisory lock key that keeps several instances from migrating at the same time.
+const migrationLock = 24001
+
+const uniqueViolation = "23505"
+
+// PostgresDB stores accounts in PostgreSQL. It follows the same rules as AccountDB: one account per type and
+// user, and an account must be closed before it can be deleted.
+type PostgresDB struct {
+	DB *sql.DB
+	// Timeout bounds every query or transaction. Zero means 10 seconds.
+	Timeout time.Duration
+	// CursorSecret signs the continuation tokens of paged results.
+	CursorSecret []byte
+	// AuditSecret keys the hashes of the audit log.
+	AuditSecret []byte
+}
+
+// Migrate applies every migration from db/migrations that has not been applied yet, in file name order.
+func (receiver PostgresDB) Migrate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := receiver.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLock); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLock)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations
+		(version TEXT PRIMARY KEY, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())`)
+	if err != nil {
+		return err
+	}
+
+	files, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	for _, file := range files {
+		version := strings.TrimSuffix(file.Name(), ".sql")
+
+		var applied bool
+		err := conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)",
+			version).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		script, err := migrations.ReadFile(path.Join("migrations", file.Name()))
+		if err != nil {
+			return err
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			_ = tx.Rollback()
+			return errors.New("migration " + version + ": " + err.Error())
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func userID(account model.Account) string {
+	return strings.TrimPrefix(util.GetPK(account.PK), "USER#")
+}
+
+func accountID(account model.Account) string {
+	return strings.TrimPrefix(util.GetSK(account.SK), "ACCOUNT#")
+}
+
+const accountColumns = `user_id, account_id, amount, "limit", type, open_date, close_date, version, frozen`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAccount(row scanner) (model.Account, error) {
+	var acc model.Account
+	var closeDate sql.NullTime
+
+	err := row.Scan(&acc.PK, &acc.SK, &acc.Amount, &acc.Limit, &acc.Type, &acc.OpenDate, &closeDate,
+		&acc.Version, &acc.Frozen)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	acc.PK = util.GetPK(acc.PK)
+	acc.SK = util.GetSK(acc.SK)
+	if closeDate.Valid {
+		acc.CloseDate = &closeDate.Time
+	}
+	return acc, nil
+}
+
+func (receiver PostgresDB) withTx(ctx context.Context, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	tx, err := receiver.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(ctx, tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockAccount reads an account and locks its row until the end of the transaction.
+func lockAccount(ctx context.Context, tx *sql.Tx, account model.Account) (model.Account, error) {
+	acc, err := scanAccount(tx.QueryRowContext(ctx,
+		"SELECT "+accountColumns+" FROM accounts WHERE user_id = $1 AND account_id = $2 FOR UPDATE",
+		userID(account), accountID(account)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Account{}, util.InvalidAccount
+	}
+	return acc, err
+}
+
+func (receiver PostgresDB) Create(ctx context.Context, account model.Account) error {
+	err := receiver.withTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO accounts ("+accountColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+			userID(account), accountID(account), account.Amount, account.Limit, account.Type, account.OpenDate,
+			account.CloseDate, account.Version, account.Frozen)
+		if err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, model.NewAccountOpened(account))
+	})
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return util.AlreadyExists
+	}
+	return err
+}
+
+func (receiver PostgresDB) GetAll(ctx context.Context, id, t string) ([]model.Account, error) {
+	query := "SELECT " + accountColumns + " FROM accounts WHERE user_id = $1"
+	if t == "open" {
+		query += " AND close_date IS NULL"
+	} else if t == "closed" {
+		query += " AND close_date IS NOT NULL"
+	}
+	query += " ORDER BY account_id"
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	rows, err := receiver.DB.QueryContext(ctx, query, strings.TrimPrefix(util.GetPK(id), "USER#"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []model.Account
+	for rows.Next() {
+		acc, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, acc)
+	}
+	return accounts, rows.Err()
+}
+
+func (receiver PostgresDB) GetAllPage(ctx context.Context, id, t string, limit int32,
+	cursor string) ([]model.Account, string, error) {
+
+	position, err := decodeCursor(receiver.CursorSecret, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if position != nil && position["PK"] != util.GetPK(id) {
+		return nil, "", util.InvalidCursor
+	}
+
+	// One extra row tells whether there is a next page.
+	args := []any{strings.TrimPrefix(util.GetPK(id), "USER#"), limit + 1}
+	query := "SELECT " + accountColumns + " FROM accounts WHERE user_id = $1"
+	if t == "open" {
+		query += " AND close_date IS NULL"
+	} else if t == "closed" {
+		query += " AND close_date IS NOT NULL"
+	}
+	if position != nil {
+		query += " AND account_id > $3"
+		args = append(args, strings.TrimPrefix(position["SK"], "ACCOUNT#"))
+	}
+	query += " ORDER BY account_id LIMIT $2"
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	rows, err := receiver.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var accounts []model.Account
+	for rows.Next() {
+		acc, err := scanAccount(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		accounts = append(accounts, acc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(accounts) <= int(limit) {
+		return accounts, "", nil
+	}
+
+	accounts = accounts[:limit]
+	last := accounts[len(accounts)-1]
+	return accounts, encodeCursor(receiver.CursorSecret, map[string]string{"PK": last.PK, "SK": last.SK}), nil
+}
+
+func (receiver PostgresDB) GetAccount(ctx context.Context, account model.Account) (model.Account, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	acc, err := scanAccount(receiver.DB.QueryRowContext(ctx,
+		"SELECT "+accountColumns+" FROM accounts WHERE user_id = $1 AND account_id = $2",
+		userID(account), accountID(account)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Account{}, nil
+	}
+	return acc, err
+}
+
+func (receiver PostgresDB) depositWithdraw(ctx context.Context, account model.Account, amount model.Money,
+	deposit bool) error {
+
+	return receiver.withTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		acc, err := lockAccount(ctx, tx, account)
+		if err != nil {
+			return err
+		}
+
+		if account.CheckVersion && acc.Version != account.Version {
+			return util.VersionMismatch
+		}
+
+		if acc.Frozen {
+			return util.FrozenAccount
+		}
+
+		if isClosed(acc) {
+			return util.ClosedAccount
+		}
+
+		entryType := model.LedgerDeposit
+		event := model.NewAccountDeposited(acc, amount, "")
+		if !deposit {
+			if acc.Amount-amount < -model.NewMoney(int64(acc.Limit)) {
+				return util.InsufficientFounds
+			}
+			entryType = model.LedgerWithdrawal
+			event = model.NewAccountWithdrawn(acc, amount, "")
+			amount = -amount
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE accounts SET amount = amount + $3, version = version + 1 WHERE user_id = $1 AND account_id = $2",
+			userID(account), accountID(account), amount)
+		if err != nil {
+			return err
+		}
+		if err := insertLedger(ctx, tx, model.NewLedgerEntry(acc, entryType, amount, "")); err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, event)
+	})
+}
+
+func (receiver PostgresDB) Deposit(ctx context.Context, account model.Account, amount model.Money) error {
+	return receiver.depositWithdraw(ctx, account, amount, true)
+}
+
+func (receiver PostgresDB) Withdraw(ctx context.Context, account model.Account, amount model.Money) error {
+	return receiver.depositWithdraw(ctx, account, amount, false)
+}
+
+func (receiver PostgresDB) Transfer(ctx context.Context, sender, recipient model.Account, amount model.Money) error {
+	if userID(sender) == userID(recipient) && accountID(sender) == accountID(recipient) {
+		return util.SameAccount
+	}
+
+	return receiver.withTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		// Lock both rows in key order, so two opposite transfers can't deadlock.
+		swapped := userID(recipient) < userID(sender) ||
+			(userID(recipient) == userID(sender) && accountID(recipient) < accountID(sender))
+
+		first, second := sender, recipient
+		if swapped {
+			first, second = recipient, sender
+		}
+
+		a, err := lockAccount(ctx, tx, first)
+		if err != nil {
+			return err
+		}
+		b, err := lockAccount(ctx, tx, second)
+		if err != nil {
+			return err
+		}
+
+		from, to := a, b
+		if swapped {
+			from, to = b, a
+		}
+
+		if sender.CheckVersion && from.Version != sender.Version {
+			return util.VersionMismatch
+		}
+		if from.Frozen || to.Frozen {
+			return util.FrozenAccount
+		}
+		if isClosed(from) || isClosed(to) {
+			return util.ClosedAccount
+		}
+		if from.Amount-amount < -model.NewMoney(int64(from.Limit)) {
+			return util.InsufficientFounds
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE accounts SET amount = amount - $3, version = version + 1 WHERE user_id = $1 AND account_id = $2",
+			userID(sender), accountID(sender), amount)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE accounts SET amount = amount + $3, version = version + 1 WHERE user_id = $1 AND account_id = $2",
+			userID(recipient), accountID(recipient), amount)
+		if err != nil {
+			return err
+		}
+
+		if err := insertLedger(ctx, tx, model.NewLedgerEntry(from, model.LedgerTransferOut, -amount, to.SK)); err != nil {
+			return err
+		}
+		if err := insertLedger(ctx, tx, model.NewLedgerEntry(to, model.LedgerTransferIn, amount, from.SK)); err != nil {
+			return err
+		}
+		if err := insertEvent(ctx, tx, model.NewAccountWithdrawn(from, amount, to.SK)); err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, model.NewAccountDeposited(to, amount, from.SK))
+	})
+}
+
+func (receiver PostgresDB) Close(ctx context.Context, account model.Account) error {
+	return receiver.withTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		acc, err := lockAccount(ctx, tx, account)
+		if err != nil {
+			return err
+		}
+
+		if account.CheckVersion && acc.Version != account.Version {
+			return util.VersionMismatch
+		}
+
+		if acc.Frozen {
+			return util.FrozenAccount
+		}
+
+		if isClosed(acc) {
+			return util.AlreadyClosed
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE accounts SET close_date = date_trunc('second', now()), version = version + 1 "+
+			"WHERE user_id = $1 AND account_id = $2",
+			userID(account), accountID(account))
+		if err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, model.NewAccountClosed(acc))
+	})
+}
+
+func (receiver PostgresDB) Delete(ctx context.Context, account model.Account) error {
+	return receiver.withTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		acc, err := lockAccount(ctx, tx, account)
+		if err != nil {
+			return err
+		}
+
+		if account.CheckVersion && acc.Version != account.Version {
+			return util.VersionMismatch
+		}
+
+		if acc.Frozen {
+			return util.FrozenAccount
+		}
+
+		if acc.CloseDate == nil {
+			return util.OpenAccount
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM accounts WHERE user_id = $1 AND account_id = $2",
+			userID(account), accountID(account))
+		if err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, model.NewAccountDeleted(acc))
+	})
+}
+
+func insertLedger(ctx context.Context, tx *sql.Tx, entry model.LedgerEntry) error {
+	var counterparty sql.NullString
+	if entry.CounterpartyID != "" {
+		counterparty = sql.NullString{String: entry.CounterpartyID, Valid: true}
+	}
+
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO ledger (id, user_id, account_id, type, amount, counterparty_id, date) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		entry.ID, strings.TrimPrefix(entry.PK, "USER#"), entry.AccountID, entry.Type, entry.Amount, counterparty,
+		entry.Date)
+	return err
+}
+
+func (receiver PostgresDB) GetLedger(ctx context.Context, account model.Account, limit int32,
+	cursor string) ([]model.LedgerEntry, string, error) {
+
+	position, err := decodeCursor(receiver.CursorSecret, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	args := []any{userID(account), accountID(account), limit}
+	query := "SELECT id, type, amount, counterparty_id, date FROM ledger WHERE user_id = $1 AND account_id = $2"
+	if position != nil {
+		date, err := time.Parse(time.RFC3339Nano, position["date"])
+		if err != nil || !util.IsValidUUID(position["id"]) {
+			return nil, "", util.InvalidCursor
+		}
+		query += " AND (date, id) < ($4, $5)"
+		args = append(args, date, position["id"])
+	}
+	query += " ORDER BY date DESC, id DESC LIMIT $3"
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	rows, err := receiver.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var entries []model.LedgerEntry
+	for rows.Next() {
+		entry := model.LedgerEntry{
+			PK:        util.GetPK(account.PK),
+			AccountID: accountID(account),
+		}
+
+		var counterparty sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.Type, &entry.Amount, &counterparty, &entry.Date); err != nil {
+			return nil, "", err
+		}
+		entry.CounterpartyID = counterparty.String
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(entries) < int(limit) {
+		return entries, "", nil
+	}
+
+	last := entries[len(entries)-1]
+	return entries, encodeCursor(receiver.CursorSecret, map[string]string{
+		"date": last.Date.Format(time.RFC3339Nano),
+		"id":   last.ID,
+	}), nil
+}
+
+func insertEvent(ctx context.Context, tx *sql.Tx, event model.Event) error {
+	event = withCorrelation(ctx, event)
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO outbox (id, occurred_at, payload) VALUES ($1, $2, $3)",
+		event.ID, event.OccurredAt, payload)
+	return err
+}
+
+func (receiver PostgresDB) PendingEvents(ctx context.Context, limit int32) ([]model.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	rows, err := receiver.DB.QueryContext(ctx,
+		"SELECT payload FROM outbox WHERE sent_at IS NULL ORDER BY occurred_at, id LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.Event
+	for rows.Next() {
+		var payload []byte
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+
+		var event model.Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (receiver PostgresDB) MarkEventSent(ctx context.Context, event model.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	_, err := receiver.DB.ExecContext(ctx, "UPDATE outbox SET sent_at = now() WHERE id = $1", event.ID)
+	return err
+}
+
+func (receiver PostgresDB) CountPendingEvents(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	var count int64
+	err := receiver.DB.QueryRowContext(ctx, "SELECT count(*) FROM outbox WHERE sent_at IS NULL").Scan(&count)
+	return count, err
+}
+
+func idempotencyKey(record model.IdempotencyRecord) (string, string) {
+	return strings.TrimPrefix(record.PK, "USER#"), strings.TrimPrefix(record.SK, "IDEMPOTENCY#")
+}
+
+func (receiver PostgresDB) ReserveIdempotency(ctx context.Context,
+	record model.IdempotencyRecord) (model.IdempotencyRecord, bool, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	user, key := idempotencyKey(record)
+
+	result, err := receiver.DB.ExecContext(ctx, `INSERT INTO idempotency_keys (user_id, key, fingerprint, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET fingerprint = excluded.fingerprint, status = 0, content_type = '', body = NULL, headers = NULL,
+			expires_at = excluded.expires_at
+		WHERE idempotency_keys.expires_at < now()`,
+		user, key, record.Fingerprint, time.Unix(record.ExpiresAt, 0))
+	if err != nil {
+		return model.IdempotencyRecord{}, false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return model.IdempotencyRecord{}, false, err
+	}
+	if n == 1 {
+		return record, true, nil
+	}
+
+	stored := model.IdempotencyRecord{PK: record.PK, SK: record.SK}
+	var headers []byte
+	var expiresAt time.Time
+	err = receiver.DB.QueryRowContext(ctx, `SELECT fingerprint, status, content_type, body, headers, expires_at
+		FROM idempotency_keys WHERE user_id = $1 AND key = $2`, user, key).
+		Scan(&stored.Fingerprint, &stored.Status, &stored.ContentType, &stored.Body, &headers, &expiresAt)
+	if err != nil {
+		return model.IdempotencyRecord{}, false, err
+	}
+	if headers != nil {
+		if err := json.Unmarshal(headers, &stored.Headers); err != nil {
+			return model.IdempotencyRecord{}, false, err
+		}
+	}
+	stored.ExpiresAt = expiresAt.Unix()
+	return stored, false, nil
+}
+
+func (receiver PostgresDB) SaveIdempotency(ctx context.Context, record model.IdempotencyRecord) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	user, key := idempotencyKey(record)
+
+	var headers []byte
+	if record.Headers != nil {
+		encoded, err := json.Marshal(record.Headers)
+		if err != nil {
+			return err
+		}
+		headers = encoded
+	}
+
+	_, err := receiver.DB.ExecContext(ctx, `UPDATE idempotency_keys
+		SET status = $3, content_type = $4, body = $5, headers = $6, expires_at = $7 WHERE user_id = $1 AND key = $2`,
+		user, key, record.Status, record.ContentType, record.Body, headers, time.Unix(record.ExpiresAt, 0))
+	return err
+}
+
+func (receiver PostgresDB) DeleteIdempotency(ctx context.Context, record model.IdempotencyRecord) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	user, key := idempotencyKey(record)
+
+	_, err := receiver.DB.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2",
+		user, key)
+	return err
+}
+
+func (receiver PostgresDB) Ping(ctx context.Context) error {
+	return receiver.DB.PingContext(ctx)
+}
+
+func (receiver PostgresDB) CountOpenAccounts(ctx context.Context) (map[string]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	rows, err := receiver.DB.QueryContext(ctx,
+		"SELECT type, COUNT(*) FROM accounts WHERE close_date IS NULL GROUP BY type")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var t string
+		var count int64
+		if err := rows.Scan(&t, &count); err != nil {
+			return nil, err
+		}
+		counts[t] = count
+	}
+	return counts, rows.Err()
+}
+
+const auditColumns = "id, user_id, account_id, sequence, action, actor, ip, reason, correlation_id, outcome, status, " +
+	"error, before, after, date, prev_hash, hash"
+
+func scanAudit(row scanner) (model.AuditEntry, error) {
+	var entry model.AuditEntry
+	var before, after []byte
+
+	err := row.Scan(&entry.ID, &entry.UserID, &entry.AccountID, &entry.Sequence, &entry.Action, &entry.Actor,
+		&entry.IP, &entry.Reason, &entry.CorrelationID, &entry.Outcome, &entry.Status, &entry.Error, &before, &after,
+		&entry.Date, &entry.PrevHash, &entry.Hash)
+	if err != nil {
+		return model.AuditEntry{}, err
+	}
+
+	entry.PK = util.GetPK(entry.UserID)
+	if before != nil {
+		if err := json.Unmarshal(before, &entry.Before); err != nil {
+			return model.AuditEntry{}, err
+		}
+	}
+	if after != nil {
+		if err := json.Unmarshal(after, &entry.After); err != nil {
+			return model.AuditEntry{}, err
+		}
+	}
+	return entry, nil
+}
+
+// insertAudit appends entry to its chain, hashed with key. The chain stays locked until the end of the transaction, so
+// concurrent entries are appended one after the other.
+func insertAudit(ctx context.Context, tx *sql.Tx, entry model.AuditEntry, key []byte) error {
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", entry.UserID+"#"+entry.AccountID)
+	if err != nil {
+		return err
+	}
+
+	head, err := scanAudit(tx.QueryRowContext(ctx, "SELECT "+auditColumns+" FROM audit_log "+
+		"WHERE user_id = $1 AND account_id = $2 AND sequence > 0 ORDER BY sequence DESC LIMIT 1",
+		entry.UserID, entry.AccountID))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		entry = entry.Chain(nil, key)
+	case err != nil:
+		return err
+	default:
+		entry = entry.Chain(&head, key)
+	}
+
+	var before, after []byte
+	if entry.Before != nil {
+		if before, err = json.Marshal(entry.Before); err != nil {
+			return err
+		}
+	}
+	if entry.After != nil {
+		if after, err = json.Marshal(entry.After); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO audit_log ("+auditColumns+") "+
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)",
+		entry.ID, entry.UserID, entry.AccountID, entry.Sequence, entry.Action, entry.Actor, entry.IP, entry.Reason,
+		entry.CorrelationID, entry.Outcome, entry.Status, entry.Error, before, after, entry.Date, entry.PrevHash,
+		entry.Hash)
+	return err
+}
+
+func (receiver PostgresDB) Audit(ctx context.Context, entry model.AuditEntry) error {
+	return receiver.withTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		return insertAudit(ctx, tx, entry, receiver.AuditSecret)
+	})
+}
+
+func (receiver PostgresDB) AuditTrail(ctx context.Context, userID, accountID string) ([]model.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	rows, err := receiver.DB.QueryContext(ctx, "SELECT "+auditColumns+" FROM audit_log "+
+		"WHERE user_id = $1 AND account_id = $2 AND sequence > 0 ORDER BY sequence",
+		strings.TrimPrefix(util.GetPK(userID), "USER#"), accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.AuditEntry
+	for rows.Next() {
+		entry, err := scanAudit(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (receiver PostgresDB) adminUpdate(ctx context.Context, account model.Account, entry model.AuditEntry,
+	change func(acc *model.Account) ([]model.Event, error)) (model.Account, error) {
+
+	var after model.Account
+	err := receiver.withTx(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		before, err := lockAccount(ctx, tx, account)
+		if err != nil {
+			return err
+		}
+
+		after = before
+		events, err := change(&after)
+		if err != nil {
+			return err
+		}
+		after.Version++
+
+		_, err = tx.ExecContext(ctx, `UPDATE accounts SET frozen = $3, "limit" = $4, close_date = $5, version = $6 `+
+			"WHERE user_id = $1 AND account_id = $2",
+			userID(account), accountID(account), after.Frozen, after.Limit, after.CloseDate, after.Version)
+		if err != nil {
+			return err
+		}
+
+		entry.Before, entry.After = &before, &after
+		if err := insertAudit(ctx, tx, entry, receiver.AuditSecret); err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := insertEvent(ctx, tx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return model.Account{}, err
+	}
+	return after, nil
+}
+
+func (receiver PostgresDB) Freeze(ctx context.Context, account model.Account, frozen bool,
+	entry model.AuditEntry) (model.Account, error) {
+
+	return receiver.adminUpdate(ctx, account, entry, func(acc *model.Account) ([]model.Event, error) {
+		return nil, freeze(acc, frozen)
+	})
+}
+
+func (receiver PostgresDB) SetLimit(ctx context.Context, account model.Account, limit int,
+	entry model.AuditEntry) (model.Account, error) {
+
+	return receiver.adminUpdate(ctx, account, entry, func(acc *model.Account) ([]model.Event, error) {
+		return nil, setLimit(acc, limit)
+	})
+}
+
+func (receiver PostgresDB) ForceClose(ctx context.Context, account model.Account,
+	entry model.AuditEntry) (model.Account, error) {
+
+	return receiver.adminUpdate(ctx, account, entry, func(acc *model.Account) ([]model.Event, error) {
+		return forceClose(acc)
+	})
+}
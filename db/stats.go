@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"main/util"
+	"strings"
+)
+
+func (receiver AccountDB) Ping(ctx context.Context) error {
+	_, err := receiver.Client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(util.TableName),
+	})
+	return err
+}
+
+// statsPK is the partition of the counters that CountOpenAccounts reads instead of scanning the table.
+const statsPK = "STATS"
+
+// openCountPrefix starts the sort keys of the open account counters, one per account type. The item with just the
+// prefix as sort key marks that the counters were seeded.
+const openCountPrefix = "OPEN"
+
+func openCountKey(accountType string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"PK": &types.AttributeValueMemberS{Value: statsPK},
+		"SK": &types.AttributeValueMemberS{Value: openCountPrefix + "#" + accountType},
+	}
+}
+
+// openCountUpdate returns the transaction item that changes the number of open accounts of accountType by delta.
+// Every write that opens or closes an account must include it.
+func openCountUpdate(accountType string, delta int64) (types.TransactWriteItem, error) {
+	expr, err := expression.NewBuilder().
+		WithUpdate(expression.Add(expression.Name("Count"), expression.Value(delta))).Build()
+	if err != nil {
+		return types.TransactWriteItem{}, err
+	}
+
+	return types.TransactWriteItem{
+		Update: &types.Update{
+			Key:                       openCountKey(accountType),
+			TableName:                 aws.String(util.TableName),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			UpdateExpression:          expr.Update(),
+		},
+	}, nil
+}
+
+// CountOpenAccounts reads the counters that the account writes keep up to date. The first call on a table without
+// them seeds them with a scan.
+func (receiver AccountDB) CountOpenAccounts(ctx context.Context) (map[string]int64, error) {
+	counts, seeded, err := receiver.openCounts(ctx)
+	if err != nil || seeded {
+		return counts, err
+	}
+
+	if err := receiver.seedOpenCounts(ctx, counts); err != nil {
+		return nil, err
+	}
+	counts, _, err = receiver.openCounts(ctx)
+	return counts, err
+}
+
+// openCounts returns the open account counters and whether they were seeded.
+func (receiver AccountDB) openCounts(ctx context.Context) (map[string]int64, bool, error) {
+	keyCond := expression.KeyAnd(
+		expression.Key("PK").Equal(expression.Value(statsPK)),
+		expression.Key("SK").BeginsWith(openCountPrefix),
+	)
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, false, err
+	}
+
+	paginator := dynamodb.NewQueryPaginator(receiver.Client, &dynamodb.QueryInput{
+		TableName:                 aws.String(util.TableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ConsistentRead:            aws.Bool(true),
+	})
+
+	counts := make(map[string]int64)
+	seeded := false
+	for paginator.HasMorePages() {
+		ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return nil, false, err
+		}
+
+		var counters []struct {
+			SK    string
+			Count int64
+		}
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &counters); err != nil {
+			return nil, false, err
+		}
+		for _, counter := range counters {
+			if counter.SK == openCountPrefix {
+				seeded = true
+				continue
+			}
+			counts[strings.TrimPrefix(counter.SK, openCountPrefix+"#")] = counter.Count
+		}
+	}
+	return counts, seeded, nil
+}
+
+// seedOpenCounts sets the counters to the open accounts found by a scan, including those in counters that have no
+// open accounts left. Accounts opened or closed while the scan runs can be off by one; later changes are exact.
+func (receiver AccountDB) seedOpenCounts(ctx context.Context, counters map[string]int64) error {
+	counts, err := receiver.scanOpenAccounts(ctx)
+	if err != nil {
+		return err
+	}
+	for accountType := range counters {
+		if _, ok := counts[accountType]; !ok {
+			counts[accountType] = 0
+		}
+	}
+
+	marker, err := expression.NewBuilder().WithCondition(expression.Name("PK").AttributeNotExists()).Build()
+	if err != nil {
+		return err
+	}
+	items := []types.TransactWriteItem{
+		{
+			Put: &types.Put{
+				Item: map[string]types.AttributeValue{
+					"PK": &types.AttributeValueMemberS{Value: statsPK},
+					"SK": &types.AttributeValueMemberS{Value: openCountPrefix},
+				},
+				TableName:                aws.String(util.TableName),
+				ConditionExpression:      marker.Condition(),
+				ExpressionAttributeNames: marker.Names(),
+			},
+		},
+	}
+
+	for accountType, count := range counts {
+		expr, err := expression.NewBuilder().
+			WithUpdate(expression.Set(expression.Name("Count"), expression.Value(count))).Build()
+		if err != nil {
+			return err
+		}
+		items = append(items, types.TransactWriteItem{
+			Update: &types.Update{
+				Key:                       openCountKey(accountType),
+				TableName:                 aws.String(util.TableName),
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				UpdateExpression:          expr.Update(),
+			},
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+	defer cancel()
+
+	_, err = receiver.Client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	// Another instance seeded the counters first.
+	if _, ok := conditionFailure(err); ok {
+		return nil
+	}
+	return err
+}
+
+// scanOpenAccounts counts the open accounts by scanning the whole table, so it is only used to seed the counters.
+func (receiver AccountDB) scanOpenAccounts(ctx context.Context) (map[string]int64, error) {
+	filter := expression.Name("SK").BeginsWith("ACCOUNT#").And(expression.Name("CloseDate").AttributeNotExists())
+	expr, err := expression.NewBuilder().WithFilter(filter).WithProjection(expression.NamesList(expression.Name("Type"))).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	paginator := dynamodb.NewScanPaginator(receiver.Client, &dynamodb.ScanInput{
+		TableName:                 aws.String(util.TableName),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+	})
+
+	counts := make(map[string]int64)
+	for paginator.HasMorePages() {
+		ctx, cancel := context.WithTimeout(ctx, timeout(receiver.Timeout))
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		var accounts []struct{ Type string }
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &accounts); err != nil {
+			return nil, err
+		}
+		for _, account := range accounts {
+			counts[account.Type]++
+		}
+	}
+	return counts, nil
+}
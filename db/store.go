@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"main/model"
+	"main/util"
+	"time"
+)
+
+// defaultTimeout bounds a database call when the backend has no Timeout.
+const defaultTimeout = 10 * time.Second
+
+func timeout(configured time.Duration) time.Duration {
+	if configured > 0 {
+		return configured
+	}
+	return defaultTimeout
+}
+
+// AccountStore is implemented by every account storage backend. Implementations must return the errors from the
+// util package (AlreadyExists, InsufficientFounds, OpenAccount, ...) so handlers can map them to status codes.
+// Every method takes the request context, which bounds the call and carries the correlation ID for its events.
+type AccountStore interface {
+	Create(ctx context.Context, account model.Account) error
+	GetAll(ctx context.Context, id, t string) ([]model.Account, error)
+	// GetAllPage returns up to limit accounts of GetAll, ordered by account ID. The returned cursor is empty on the
+	// last page.
+	GetAllPage(ctx context.Context, id, t string, limit int32, cursor string) ([]model.Account, string, error)
+	GetAccount(ctx context.Context, account model.Account) (model.Account, error)
+	Deposit(ctx context.Context, account model.Account, amount model.Money) error
+	Withdraw(ctx context.Context, account model.Account, amount model.Money) error
+	Transfer(ctx context.Context, sender, recipient model.Account, amount model.Money) error
+	Close(ctx context.Context, account model.Account) error
+	Delete(ctx context.Context, account model.Account) error
+	// GetLedger returns the newest ledger entries of an account first, up to limit entries per page. The returned
+	// cursor is empty on the last page.
+	GetLedger(ctx context.Context, account model.Account, limit int32, cursor string) ([]model.LedgerEntry, string, error)
+}
+
+// IdempotencyStore keeps the responses of requests sent with an Idempotency-Key header.
+type IdempotencyStore interface {
+	// ReserveIdempotency stores record unless a record with the same key that has not expired exists yet. If it
+	// does, the stored record is returned and reserved is false.
+	ReserveIdempotency(ctx context.Context, record model.IdempotencyRecord) (stored model.IdempotencyRecord,
+		reserved bool, err error)
+	SaveIdempotency(ctx context.Context, record model.IdempotencyRecord) error
+	DeleteIdempotency(ctx context.Context, record model.IdempotencyRecord) error
+}
+
+// Outbox holds the domain events that were written together with the account changes, until the relay has
+// published them. Every account change must add its events to the outbox in the same transaction.
+type Outbox interface {
+	// PendingEvents returns up to limit unpublished events, oldest first.
+	PendingEvents(ctx context.Context, limit int32) ([]model.Event, error)
+	MarkEventSent(ctx context.Context, event model.Event) error
+	CountPendingEvents(ctx context.Context) (int64, error)
+}
+
+// withCorrelation tags event with the correlation ID of the request that caused it.
+func withCorrelation(ctx context.Context, event model.Event) model.Event {
+	event.CorrelationID = util.CorrelationID(ctx)
+	return event
+}
+
+// AuditStore keeps the audit log. The entries of every account are chained: each one is stored with the hash of the
+// entry before it, and appending to a chain that was appended to concurrently must not fork it.
+type AuditStore interface {
+	// Audit appends entry to the chain of its account.
+	Audit(ctx context.Context, entry model.AuditEntry) error
+	// AuditTrail returns the chain of an account, oldest first. An empty accountID returns the chain of the actions
+	// on all accounts of the user.
+	AuditTrail(ctx context.Context, userID, accountID string) ([]model.AuditEntry, error)
+}
+
+// AdminStore backs the admin API. Every change is appended to the audit log in the same transaction, and the entry
+// gets the account before and after the change.
+type AdminStore interface {
+	// Freeze freezes an account or, with frozen false, unfreezes it. It returns AlreadyFrozen or NotFrozen if there
+	// is nothing to change.
+	Freeze(ctx context.Context, account model.Account, frozen bool, entry model.AuditEntry) (model.Account, error)
+	SetLimit(ctx context.Context, account model.Account, limit int, entry model.AuditEntry) (model.Account, error)
+	// ForceClose closes an account, even a frozen one, and unfreezes it.
+	ForceClose(ctx context.Context, account model.Account, entry model.AuditEntry) (model.Account, error)
+}
+
+// Stats reports business figures for the metrics.
+type Stats interface {
+	// CountOpenAccounts returns the number of open accounts per account type.
+	CountOpenAccounts(ctx context.Context) (map[string]int64, error)
+}
+
+// Store is the complete storage backend the service runs on.
+type Store interface {
+	// Ping checks that the backend can be reached.
+	Ping(ctx context.Context) error
+	AccountStore
+	IdempotencyStore
+	Outbox
+	AuditStore
+	AdminStore
+	Stats
+}
+
+var _ Store = AccountDB{}
+var _ Store = (*MemoryDB)(nil)
+var _ Store = PostgresDB{}
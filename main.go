@@ -2,20 +2,26 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"log"
+	"main/config"
 	"main/controller"
 	"main/db"
 	_ "main/docs"
 	"main/env"
 	"main/messaging"
+	"main/metrics"
+	"main/model"
+	"main/tracing"
 	"main/util"
 	"net/http"
 	"os"
@@ -51,70 +57,169 @@ func main() {
 		log.Fatalf("failed to load env variables: %s", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("invalid configuration:\n%s", err)
+	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(os.Getenv("REGION")),
-		config.WithEndpointResolver(aws.EndpointResolverFunc(
-			func(service, region string) (aws.Endpoint, error) {
-				return aws.Endpoint{URL: "http://dynamodb:8000"}, nil
-			})),
-		config.WithCredentialsProvider(credentials.StaticCredentialsProvider{
-			Value: aws.Credentials{
-				AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
-				SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
-			},
-		}),
-	)
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing.Exporter)
 	if err != nil {
-		log.Fatalf("failed to load SDK config, %s", err)
+		log.Fatalf("failed to init tracing: %s", err)
 	}
 
+	var store db.Store
+	switch cfg.Database.Backend {
+	case "dynamodb":
+		store = newAccountDB(cfg)
+	case "postgres":
+		store = newPostgresDB(cfg)
+	case "memory":
+		store = &db.MemoryDB{
+			CursorSecret: []byte(cfg.Auth.CursorSecret),
+			AuditSecret:  []byte(cfg.Auth.AuditSecret),
+		}
+	}
+
+	services := util.Services{
+		TransactionAPI: cfg.Services.TransactionAPI,
+		AccountStat:    cfg.Services.AccountStat,
+		Timeout:        cfg.Services.Timeout,
+	}
 	accountController := controller.AccountController{
-		DB: &db.AccountDB{
-			Client: dynamodb.NewFromConfig(cfg),
-		},
+		DB:         store,
+		Services:   services,
+		TypesLimit: cfg.AccountTypesLimit,
+	}
+	adminController := controller.AdminController{
+		DB:          store,
+		AuditSecret: []byte(cfg.Auth.AuditSecret),
+	}
+	auditLog := controller.AuditLog{
+		DB: store,
 	}
+	idempotency := controller.Idempotency{
+		DB: store,
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
 
-	gin.SetMode(os.Getenv("GIN_MODE"))
+	go metrics.AccountStats{Store: store}.Run(workerCtx)
+	go metrics.OutboxStats{Outbox: store}.Run(workerCtx)
+
+	health := &controller.HealthController{
+		Checks: []controller.Check{{Name: "database", Check: store.Ping}},
+	}
+	if cfg.Server.ReadyCheckTransactionAPI {
+		health.Checks = append(health.Checks,
+			controller.Check{Name: "transaction-api", Check: services.PingTransactionAPI})
+	}
+
+	auth := util.Auth{
+		Issuer:   cfg.Auth.Issuer,
+		Audience: cfg.Auth.Audience,
+		Leeway:   cfg.Auth.ClockSkew,
+	}
+	if cfg.Auth.HMACFallback {
+		auth.Secret = []byte(cfg.Auth.JWTSecret)
+	}
+	if cfg.Auth.JWKSURL != "" {
+		auth.JWKS = &util.JWKS{
+			Source:          cfg.Auth.JWKSURL,
+			RefreshInterval: cfg.Auth.JWKSRefreshInterval,
+			Timeout:         cfg.Services.Timeout,
+		}
+		if err := auth.JWKS.Refresh(workerCtx); err != nil {
+			log.Printf("error with JWKS: %s\n", err)
+		}
+		go auth.JWKS.Run(workerCtx)
+		health.Connections = append(health.Connections, controller.Connection{Name: "jwks", Checker: auth.JWKS})
+	}
+
+	publisher := &messaging.EventPublisher{
+		URL:      cfg.Messaging.AMQPURL,
+		Exchange: cfg.Messaging.EventsExchange,
+		SpoolDir: cfg.Messaging.SpoolDir,
+	}
+	if err := publisher.Init(); err != nil {
+		log.Printf("error with event publishing: %s\n", err)
+	} else {
+		defer publisher.Close()
+		health.Connections = append(health.Connections, controller.Connection{Name: "events", Checker: publisher})
+
+		relay := messaging.Relay{
+			Outbox:    store,
+			Publisher: publisher,
+		}
+		go relay.Run(workerCtx)
+	}
+
+	gin.SetMode(cfg.Server.GinMode)
 
 	router := gin.Default()
+	router.Use(util.Correlation).Use(metrics.Middleware).Use(tracing.Middleware())
 
-	msg := messaging.Messaging{}
-	err = msg.Init()
+	sink, err := messaging.OpenSink(cfg.Messaging)
 	if err != nil {
 		log.Printf("error with messaging: %s\n", err)
 	} else {
+		msg := messaging.Messaging{Sink: sink, Format: cfg.Messaging.LogFormat}
 		router.Use(msg.WriteInfo).Use(msg.WriteError)
-		defer msg.Close()
+		health.Connections = append(health.Connections, controller.Connection{Name: "logs", Checker: sink})
+		defer sink.Close()
 	}
 
 	router.Use(util.CORS)
 
-	//api := router.Group("api/v1").Use(util.ValidateToken).Use(util.UploadStat)
-	api := router.Group("api/v1").Use(util.ValidateToken)
+	//api := router.Group("api/v1").Use(auth.ValidateToken).Use(services.UploadStat)
+	api := router.Group("api/v1").Use(auth.ValidateToken)
 	{
-		api.POST("/account", accountController.Create)
+		read := util.RequireScope(util.ScopeAccountsRead)
+		write := util.RequireScope(util.ScopeAccountsWrite)
+
+		api.POST("/account", write, idempotency.Handle, auditLog.Record(model.AuditCreate), accountController.Create)
+
+		api.GET("/accounts/:type", read, accountController.GetAll)
+		api.GET("/accounts/:type/transactions", read, accountController.GetAllWithTransactions)
+		api.GET("/account/:accountID", read, accountController.GetAccount)
+		api.GET("/account/:accountID/ledger", read, accountController.GetLedger)
 
-		api.GET("/accounts/:type", accountController.GetAll)
-		api.GET("/accounts/:type/transactions", accountController.GetAllWithTransactions)
-		api.GET("/account/:accountID", accountController.GetAccount)
+		api.PATCH("/account/:accountID/deposit", write, idempotency.Handle, auditLog.Record(model.AuditDeposit),
+			accountController.Deposit)
+		api.PATCH("/account/:accountID/withdraw", write, idempotency.Handle, auditLog.Record(model.AuditWithdraw),
+			accountController.Withdraw)
+		api.PATCH("/account/:accountID/close", util.RequireScope(util.ScopeAccountsClose),
+			idempotency.Handle, auditLog.Record(model.AuditClose), accountController.Close)
 
-		api.PATCH("/account/:accountID/deposit", accountController.Deposit)
-		api.PATCH("/account/:accountID/withdraw", accountController.Withdraw)
-		api.PATCH("/account/:accountID/close", accountController.Close)
+		api.DELETE("/account/:accountID", util.RequireScope(util.ScopeAccountsDelete),
+			auditLog.Record(model.AuditDelete), accountController.Delete)
 
-		api.DELETE("/account/:accountID", accountController.Delete)
+		api.POST("/transfers", write, idempotency.Handle, auditLog.RecordTransfer, accountController.Transfer)
 	}
-	router.GET("api/v1/login", util.RandomToken)
+
+	admin := router.Group("api/v1/admin").Use(auth.ValidateToken).Use(util.RequireRole(util.AdminRole))
+	{
+		admin.GET("/users/:userID/accounts", adminController.ListAccounts)
+		admin.GET("/users/:userID/accounts/:accountID", adminController.GetAccount)
+		admin.POST("/users/:userID/accounts/:accountID/freeze", adminController.Freeze)
+		admin.POST("/users/:userID/accounts/:accountID/unfreeze", adminController.Unfreeze)
+		admin.PATCH("/users/:userID/accounts/:accountID/limit", adminController.SetLimit)
+		admin.POST("/users/:userID/accounts/:accountID/force-close", adminController.ForceClose)
+		admin.GET("/users/:userID/accounts/:accountID/audit/verify", adminController.VerifyAudit)
+		admin.GET("/users/:userID/audit/verify", adminController.VerifyUserAudit)
+	}
+	router.GET("api/v1/login", auth.RandomToken)
 	router.GET("/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/health", health.Health)
+	router.GET("/healthz", health.Live)
+	router.GET("/readyz", health.Ready)
 
 	srv := &http.Server{
-		Addr:         ":8080",
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
+		Addr:         cfg.Server.Addr,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 		Handler:      router,
 	}
 
@@ -129,12 +234,85 @@ func main() {
 	signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGTERM)
 	<-c
 
-	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	health.ShutDown()
+	// Give the load balancer time to see the failing readiness check before connections are refused.
+	time.Sleep(cfg.Server.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("Shutdown() error: %s\n", err)
 	}
+	stopWorkers()
+
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("tracing shutdown error: %s\n", err)
+	}
 
 	log.Println("shutting down")
 }
+
+func newAccountDB(cfg config.Config) *db.AccountDB {
+	options := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(cfg.Database.DynamoDB.Region)}
+	if endpoint := cfg.Database.DynamoDB.Endpoint; endpoint != "" {
+		options = append(options, awsconfig.WithEndpointResolver(aws.EndpointResolverFunc(
+			func(service, region string) (aws.Endpoint, error) {
+				return aws.Endpoint{URL: endpoint}, nil
+			})))
+	}
+	if cfg.Database.DynamoDB.AccessKeyID != "" {
+		options = append(options, awsconfig.WithCredentialsProvider(credentials.StaticCredentialsProvider{
+			Value: aws.Credentials{
+				AccessKeyID:     cfg.Database.DynamoDB.AccessKeyID,
+				SecretAccessKey: cfg.Database.DynamoDB.SecretAccessKey,
+			},
+		}))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.TODO(), options...)
+	if err != nil {
+		log.Fatalf("failed to load SDK config, %s", err)
+	}
+
+	accountDB := &db.AccountDB{
+		Client:       dynamodb.NewFromConfig(awsCfg, metrics.DynamoDB, tracing.DynamoDB),
+		Timeout:      cfg.Database.Timeout,
+		CursorSecret: []byte(cfg.Auth.CursorSecret),
+		AuditSecret:  []byte(cfg.Auth.AuditSecret),
+	}
+
+	if cfg.Database.MigrateMoney {
+		n, err := accountDB.MigrateMoney()
+		if err != nil {
+			log.Fatalf("failed to migrate amounts: %s", err)
+		}
+		log.Printf("migrated %d account amounts\n", n)
+	}
+	return accountDB
+}
+
+func newPostgresDB(cfg config.Config) db.PostgresDB {
+	conn, err := sql.Open("postgres", cfg.Database.PostgresURL)
+	if err != nil {
+		log.Fatalf("failed to open database: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Database.Timeout)
+	defer cancel()
+
+	if err := conn.PingContext(ctx); err != nil {
+		log.Fatalf("failed to connect to database: %s", err)
+	}
+
+	postgresDB := db.PostgresDB{
+		DB:           conn,
+		Timeout:      cfg.Database.Timeout,
+		CursorSecret: []byte(cfg.Auth.CursorSecret),
+		AuditSecret:  []byte(cfg.Auth.AuditSecret),
+	}
+	if err := postgresDB.Migrate(); err != nil {
+		log.Fatalf("failed to migrate database: %s", err)
+	}
+	return postgresDB
+}
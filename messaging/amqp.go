@@ -0,0 +1,201 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"log"
+	"main/metrics"
+	"main/util"
+	"path/filepath"
+	"time"
+)
+
+// bufferSize is how many log messages are kept in memory while the broker is unreachable. Older messages go to the
+// spool. Write hands messages over through a queue of the same size.
+const bufferSize = 1000
+
+// sinkRetryInterval is how long the worker waits before it publishes again after a failure.
+const sinkRetryInterval = time.Second
+
+// AMQPSink publishes log records to Queue with publisher confirms. Write only queues a record; a background worker
+// publishes it, so requests never wait for the broker. While the broker is unreachable, records are buffered in
+// memory and spooled to SpoolDir.
+type AMQPSink struct {
+	URL      string
+	Queue    string
+	SpoolDir string
+
+	connection *Connection
+	spool      *Spool
+	cancel     context.CancelFunc
+
+	queue chan util.LogMessage
+	// ready wakes the worker after every (re)connect.
+	ready chan struct{}
+	done  chan struct{}
+}
+
+// Init starts connecting to the broker and the worker in the background. Messages written before the connection is
+// up are buffered.
+func (receiver *AMQPSink) Init() error {
+	if receiver.URL == "" {
+		return errors.New("AMQP_URL is not set")
+	}
+
+	receiver.queue = make(chan util.LogMessage, bufferSize)
+	receiver.ready = make(chan struct{}, 1)
+	receiver.done = make(chan struct{})
+	receiver.spool = &Spool{Dir: filepath.Join(receiver.SpoolDir, "logs")}
+	receiver.connection = &Connection{
+		URL: receiver.URL,
+		Setup: func(channel *amqp.Channel) error {
+			if err := channel.Confirm(false); err != nil {
+				return err
+			}
+			spoolReturns(channel, receiver.spool)
+
+			_, err := channel.QueueDeclare(
+				receiver.Queue,
+				true,
+				false,
+				false,
+				false,
+				nil,
+			)
+			return err
+		},
+		OnReady: func() {
+			select {
+			case receiver.ready <- struct{}{}:
+			default:
+			}
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	receiver.cancel = cancel
+	go receiver.connection.Run(ctx)
+	go receiver.run(ctx)
+	return nil
+}
+
+func (receiver *AMQPSink) Connected() bool {
+	return receiver.connection != nil && receiver.connection.Connected()
+}
+
+// Close stops the worker, which spools the messages that were not published yet, and closes the connection.
+func (receiver *AMQPSink) Close() {
+	if receiver.cancel != nil {
+		receiver.cancel()
+		<-receiver.done
+	}
+	if receiver.connection != nil {
+		receiver.connection.Close()
+	}
+}
+
+func (receiver *AMQPSink) logMessage(message util.LogMessage) spooledMessage {
+	return spooledMessage{
+		Exchange:   receiver.Queue,
+		RoutingKey: receiver.Queue,
+		Publishing: amqp.Publishing{
+			ContentType:   message.ContentType,
+			MessageId:     uuid.NewString(),
+			CorrelationId: message.CorrelationID,
+			Body:          message.Body,
+		},
+	}
+}
+
+func (receiver *AMQPSink) publish(ctx context.Context, channel *amqp.Channel, message util.LogMessage) error {
+	msg := receiver.logMessage(message)
+	return publishConfirmed(ctx, channel, msg.Exchange, msg.RoutingKey, msg.Publishing)
+}
+
+// deadLetter moves a message that could not be delivered to the spool. It is only lost if the spool fails too.
+func (receiver *AMQPSink) deadLetter(message util.LogMessage) {
+	if err := receiver.spool.Add(receiver.logMessage(message)); err != nil {
+		metrics.ObserveDropped()
+		log.Printf("spool error: %v, log message is lost", err)
+	}
+}
+
+// run publishes the queued messages in order until ctx is done. Messages that can't be published yet wait in
+// pending, at most bufferSize of them; older ones go to the spool. When ctx is done, every waiting message is
+// spooled, so it is published after the next start.
+func (receiver *AMQPSink) run(ctx context.Context) {
+	defer close(receiver.done)
+
+	var pending []util.LogMessage
+	retry := time.NewTicker(sinkRetryInterval)
+	defer retry.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			receiver.spoolAll(pending)
+			return
+		case message := <-receiver.queue:
+			if len(pending) == bufferSize {
+				receiver.deadLetter(pending[0])
+				pending = pending[1:]
+			}
+			pending = append(pending, message)
+		case <-receiver.ready:
+			if channel := receiver.connection.Channel(); channel != nil {
+				replaySpool(channel, receiver.spool)
+			}
+		case <-retry.C:
+		}
+		pending = receiver.send(ctx, pending)
+	}
+}
+
+// send publishes pending in order and returns the messages that are still waiting. A message the broker rejected
+// goes to the spool; any other failure stops sending until the next try.
+func (receiver *AMQPSink) send(ctx context.Context, pending []util.LogMessage) []util.LogMessage {
+	channel := receiver.connection.Channel()
+	if channel == nil {
+		return pending
+	}
+
+	for len(pending) != 0 {
+		err := receiver.publish(ctx, channel, pending[0])
+		if errors.Is(err, errNacked) {
+			receiver.deadLetter(pending[0])
+		} else if err != nil {
+			log.Printf("error with messaging: %s\n", err)
+			return pending
+		}
+		pending = pending[1:]
+	}
+	return nil
+}
+
+// spoolAll spools pending and the messages still in the queue.
+func (receiver *AMQPSink) spoolAll(pending []util.LogMessage) {
+	for _, message := range pending {
+		receiver.deadLetter(message)
+	}
+	for {
+		select {
+		case message := <-receiver.queue:
+			receiver.deadLetter(message)
+		default:
+			return
+		}
+	}
+}
+
+// Write queues message for the worker. If the worker has fallen that far behind, the message goes straight to the
+// spool instead of waiting.
+func (receiver *AMQPSink) Write(message util.LogMessage) error {
+	select {
+	case receiver.queue <- message:
+	default:
+		receiver.deadLetter(message)
+	}
+	return nil
+}
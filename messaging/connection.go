@@ -0,0 +1,121 @@
+package messaging
+
+import (
+	"context"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const minReconnectDelay = 500 * time.Millisecond
+const maxReconnectDelay = 30 * time.Second
+
+// Connection keeps an AMQP connection and channel open. Whenever either of them closes, it dials again with jittered
+// exponential backoff and runs Setup on the new channel, so the topology is declared again.
+type Connection struct {
+	URL string
+	// Setup declares what the channel needs, e.g. queues and exchanges. It runs after every reconnect.
+	Setup func(channel *amqp.Channel) error
+	// OnReady runs after every successful (re)connect.
+	OnReady func()
+
+	mu      sync.RWMutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+}
+
+// Channel returns the open channel, or nil while disconnected.
+func (receiver *Connection) Channel() *amqp.Channel {
+	receiver.mu.RLock()
+	defer receiver.mu.RUnlock()
+
+	return receiver.channel
+}
+
+func (receiver *Connection) Connected() bool {
+	return receiver.Channel() != nil
+}
+
+// Run keeps the connection open until ctx is done.
+func (receiver *Connection) Run(ctx context.Context) {
+	delay := minReconnectDelay
+	for ctx.Err() == nil {
+		connClosed, channelClosed, err := receiver.connect()
+		if err != nil {
+			wait := jitter(delay)
+			log.Printf("amqp connect error: %v, retrying in %s", err, wait)
+			delay = min(delay*2, maxReconnectDelay)
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		delay = minReconnectDelay
+		if receiver.OnReady != nil {
+			receiver.OnReady()
+		}
+
+		select {
+		case <-ctx.Done():
+		case err := <-connClosed:
+			log.Printf("amqp connection closed: %v", err)
+		case err := <-channelClosed:
+			log.Printf("amqp channel closed: %v", err)
+		}
+		receiver.Close()
+	}
+}
+
+func (receiver *Connection) connect() (chan *amqp.Error, chan *amqp.Error, error) {
+	conn, err := amqp.Dial(receiver.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	if receiver.Setup != nil {
+		if err := receiver.Setup(channel); err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+	}
+
+	// Each notification needs its own chan, because the library closes it on shutdown.
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+
+	receiver.mu.Lock()
+	receiver.conn = conn
+	receiver.channel = channel
+	receiver.mu.Unlock()
+	return connClosed, channelClosed, nil
+}
+
+// Close closes the current connection. Run dials again unless its context is done.
+func (receiver *Connection) Close() {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	if receiver.conn != nil && !receiver.conn.IsClosed() {
+		if err := receiver.conn.Close(); err != nil {
+			log.Printf("conn close error: %v", err)
+		}
+	}
+	receiver.conn = nil
+	receiver.channel = nil
+}
+
+// jitter returns a random delay between half of delay and delay, so instances don't reconnect in lockstep.
+func jitter(delay time.Duration) time.Duration {
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,112 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"main/model"
+	"path/filepath"
+	"sync"
+)
+
+var errNotConnected = errors.New("not connected to the broker")
+
+// EventPublisher publishes domain events to the Exchange topic exchange and waits for the broker to confirm each of
+// them.
+type EventPublisher struct {
+	URL      string
+	Exchange string
+	SpoolDir string
+
+	connection *Connection
+	spool      *Spool
+	cancel     context.CancelFunc
+
+	mu sync.Mutex
+}
+
+// Init starts connecting to the broker in the background. Publish fails until the connection is up.
+func (receiver *EventPublisher) Init() error {
+	if receiver.URL == "" {
+		return errors.New("AMQP_URL is not set")
+	}
+
+	receiver.spool = &Spool{Dir: filepath.Join(receiver.SpoolDir, "events")}
+	receiver.connection = &Connection{
+		URL: receiver.URL,
+		Setup: func(channel *amqp.Channel) error {
+			if err := channel.Confirm(false); err != nil {
+				return err
+			}
+			spoolReturns(channel, receiver.spool)
+
+			return channel.ExchangeDeclare(
+				receiver.Exchange,
+				amqp.ExchangeTopic,
+				true,
+				false,
+				false,
+				false,
+				nil,
+			)
+		},
+		OnReady: receiver.replay,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	receiver.cancel = cancel
+	go receiver.connection.Run(ctx)
+	return nil
+}
+
+func (receiver *EventPublisher) Connected() bool {
+	return receiver.connection != nil && receiver.connection.Connected()
+}
+
+func (receiver *EventPublisher) Close() {
+	if receiver.cancel != nil {
+		receiver.cancel()
+	}
+	if receiver.connection != nil {
+		receiver.connection.Close()
+	}
+}
+
+func (receiver *EventPublisher) replay() {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	if channel := receiver.connection.Channel(); channel != nil {
+		replaySpool(channel, receiver.spool)
+	}
+}
+
+// Publish returns once the broker has confirmed the event. A nacked event stays in the outbox and is published again
+// by the relay; an event that no queue is bound for is moved to the spool. Events are published with their ID as the
+// message ID, so consumers can drop the duplicates that at-least-once delivery allows.
+func (receiver *EventPublisher) Publish(ctx context.Context, event model.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	// Only one event is in flight at a time, so events reach the broker in outbox order.
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	channel := receiver.connection.Channel()
+	if channel == nil {
+		return errNotConnected
+	}
+
+	return publishConfirmed(ctx, channel, receiver.Exchange, event.RoutingKey(), amqp.Publishing{
+		ContentType:   "application/json",
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     event.ID,
+		CorrelationId: event.CorrelationID,
+		Timestamp:     event.OccurredAt,
+		Type:          event.Type,
+		Body:          body,
+	})
+}
@@ -0,0 +1,46 @@
+package messaging
+
+import (
+	"errors"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"log"
+	"main/util"
+)
+
+// FileSink writes one record per line to Path. The file is rotated when it grows over MaxSize megabytes, and
+// MaxBackups old files are kept.
+type FileSink struct {
+	Path       string
+	MaxSize    int
+	MaxBackups int
+
+	logger *lumberjack.Logger
+}
+
+func (receiver *FileSink) Init() error {
+	if receiver.Path == "" {
+		return errors.New("LOG_FILE is not set")
+	}
+
+	receiver.logger = &lumberjack.Logger{
+		Filename:   receiver.Path,
+		MaxSize:    receiver.MaxSize,
+		MaxBackups: receiver.MaxBackups,
+	}
+	return nil
+}
+
+func (receiver *FileSink) Write(message util.LogMessage) error {
+	_, err := receiver.logger.Write(append(message.Body, '\n'))
+	return err
+}
+
+func (receiver *FileSink) Connected() bool {
+	return true
+}
+
+func (receiver *FileSink) Close() {
+	if err := receiver.logger.Close(); err != nil {
+		log.Printf("error with log file close: %s\n", err)
+	}
+}
@@ -0,0 +1,48 @@
+package messaging
+
+import (
+	"errors"
+	"github.com/nats-io/nats.go"
+	"main/util"
+)
+
+// NATSSink publishes log records to Subject on the URL server. The client reconnects on its own and buffers records
+// while the server is unreachable.
+type NATSSink struct {
+	URL     string
+	Subject string
+
+	conn *nats.Conn
+}
+
+func (receiver *NATSSink) Init() error {
+	if receiver.URL == "" {
+		return errors.New("NATS_URL is not set")
+	}
+
+	conn, err := nats.Connect(receiver.URL, nats.Name("account-service"), nats.MaxReconnects(-1),
+		nats.RetryOnFailedConnect(true))
+	if err != nil {
+		return err
+	}
+	receiver.conn = conn
+	return nil
+}
+
+func (receiver *NATSSink) Write(message util.LogMessage) error {
+	msg := nats.NewMsg(receiver.Subject)
+	msg.Header.Set("Content-Type", message.ContentType)
+	msg.Header.Set(util.CorrelationHeader, message.CorrelationID)
+	msg.Data = message.Body
+	return receiver.conn.PublishMsg(msg)
+}
+
+func (receiver *NATSSink) Connected() bool {
+	return receiver.conn.IsConnected()
+}
+
+func (receiver *NATSSink) Close() {
+	if err := receiver.conn.Drain(); err != nil {
+		receiver.conn.Close()
+	}
+}
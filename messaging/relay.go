@@ -0,0 +1,71 @@
+package messaging
+
+import (
+	"context"
+	"log"
+	"main/db"
+	"main/metrics"
+	"main/model"
+	"time"
+)
+
+const relayBatchSize = 25
+const relayPollInterval = time.Second
+const relayMinBackoff = time.Second
+const relayMaxBackoff = time.Minute
+
+// Relay moves events from the outbox to the broker. An event is marked as sent only after the broker confirmed it,
+// so events survive broker outages and restarts, and may be published more than once.
+type Relay struct {
+	Outbox    db.Outbox
+	Publisher interface {
+		Publish(ctx context.Context, event model.Event) error
+	}
+}
+
+// Run relays events until ctx is done. After a failure it waits with exponential backoff before it tries again.
+func (receiver Relay) Run(ctx context.Context) {
+	backoff := relayMinBackoff
+	for {
+		wait := relayPollInterval
+		if err := receiver.relay(ctx); err != nil {
+			log.Printf("outbox relay error: %v, retrying in %s", err, backoff)
+			wait = backoff
+			backoff = min(backoff*2, relayMaxBackoff)
+		} else {
+			backoff = relayMinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// relay publishes pending events in order until the outbox is empty.
+func (receiver Relay) relay(ctx context.Context) error {
+	for ctx.Err() == nil {
+		events, err := receiver.Outbox.PendingEvents(ctx, relayBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			err := receiver.Publisher.Publish(ctx, event)
+			metrics.ObservePublish("events", err)
+			if err != nil {
+				return err
+			}
+			if err := receiver.Outbox.MarkEventSent(ctx, event); err != nil {
+				return err
+			}
+		}
+
+		if len(events) < relayBatchSize {
+			return nil
+		}
+	}
+	return nil
+}
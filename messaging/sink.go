@@ -0,0 +1,106 @@
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"main/config"
+	"main/util"
+	"os"
+	"sync"
+)
+
+// Sink is a destination for log records.
+type Sink interface {
+	Write(message util.LogMessage) error
+	// Connected reports whether records currently reach the destination.
+	Connected() bool
+	Close()
+}
+
+// FanOut writes every record to all of its sinks.
+type FanOut []Sink
+
+func (receiver FanOut) Write(message util.LogMessage) error {
+	var errs []error
+	for _, sink := range receiver {
+		if err := sink.Write(message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (receiver FanOut) Connected() bool {
+	for _, sink := range receiver {
+		if !sink.Connected() {
+			return false
+		}
+	}
+	return true
+}
+
+func (receiver FanOut) Close() {
+	for _, sink := range receiver {
+		sink.Close()
+	}
+}
+
+// StdoutSink writes one record per line to standard output.
+type StdoutSink struct {
+	mu sync.Mutex
+}
+
+func (receiver *StdoutSink) Write(message util.LogMessage) error {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	_, err := os.Stdout.Write(append(message.Body, '\n'))
+	return err
+}
+
+func (receiver *StdoutSink) Connected() bool {
+	return true
+}
+
+func (receiver *StdoutSink) Close() {
+}
+
+// OpenSink starts the configured sinks. More than one sink is combined in a FanOut.
+func OpenSink(cfg config.Messaging) (Sink, error) {
+	var sinks FanOut
+	for _, name := range cfg.Sinks() {
+		var sink Sink
+		var err error
+
+		switch name {
+		case "amqp":
+			amqpSink := &AMQPSink{URL: cfg.AMQPURL, Queue: cfg.LogQueue, SpoolDir: cfg.SpoolDir}
+			sink, err = amqpSink, amqpSink.Init()
+		case "file":
+			fileSink := &FileSink{
+				Path:       cfg.LogFile.Path,
+				MaxSize:    cfg.LogFile.MaxSize,
+				MaxBackups: cfg.LogFile.MaxBackups,
+			}
+			sink, err = fileSink, fileSink.Init()
+		case "stdout":
+			sink = &StdoutSink{}
+		case "nats":
+			natsSink := &NATSSink{URL: cfg.NATS.URL, Subject: cfg.NATS.Subject}
+			sink, err = natsSink, natsSink.Init()
+		default:
+			err = fmt.Errorf("unknown log sink %q", name)
+		}
+
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return sinks, nil
+}
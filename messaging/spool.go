@@ -0,0 +1,220 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errNacked = errors.New("message was rejected by the broker")
+
+type spooledMessage struct {
+	Exchange   string          `json:"exchange"`
+	RoutingKey string          `json:"routingKey"`
+	Publishing amqp.Publishing `json:"publishing"`
+}
+
+// Spool is a dead-letter store on disk. It keeps the messages the broker did not accept, one file per message, until
+// they can be published again.
+type Spool struct {
+	Dir string
+
+	mu        sync.Mutex
+	replaying sync.Mutex
+}
+
+func (receiver *Spool) Add(message spooledMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	if err := os.MkdirAll(receiver.Dir, 0o750); err != nil {
+		return err
+	}
+
+	// The time prefix keeps the files in spool order; the file is renamed into place, so replay never reads a half
+	// written message.
+	name := filepath.Join(receiver.Dir, fmt.Sprintf("%020d-%s.json", time.Now().UnixNano(), uuid.NewString()))
+	if err := os.WriteFile(name+".tmp", data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(name+".tmp", name)
+}
+
+// Replay publishes the spooled messages oldest first and removes each one the broker accepted. It stops at the first
+// failure and returns the number of replayed messages.
+func (receiver *Spool) Replay(publish func(message spooledMessage) error) (int, error) {
+	receiver.replaying.Lock()
+	defer receiver.replaying.Unlock()
+
+	receiver.mu.Lock()
+	files, err := os.ReadDir(receiver.Dir)
+	receiver.mu.Unlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		name := filepath.Join(receiver.Dir, file.Name())
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return replayed, err
+		}
+
+		var message spooledMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			log.Printf("spool: skipping unreadable message %s: %v", name, err)
+			continue
+		}
+
+		if err := publish(message); err != nil {
+			return replayed, err
+		}
+		if err := os.Remove(name); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// headerCarrier lets the trace context propagator write to AMQP headers.
+type headerCarrier amqp.Table
+
+func (receiver headerCarrier) Get(key string) string {
+	value, _ := receiver[key].(string)
+	return value
+}
+
+func (receiver headerCarrier) Set(key, value string) {
+	receiver[key] = value
+}
+
+func (receiver headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(receiver))
+	for key := range receiver {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// publishConfirmed publishes a mandatory message and waits until the broker acks or nacks it. A message that can't
+// be routed is acked as well, after it was handed to the channel's return listener. The publish is traced as a
+// child of ctx, and the trace context is sent in the message headers.
+func publishConfirmed(ctx context.Context, channel *amqp.Channel, exchange, key string, message amqp.Publishing) error {
+	destination := exchange
+	if destination == "" {
+		destination = key
+	}
+
+	ctx, span := otel.Tracer("main/messaging").Start(ctx, destination+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemRabbitmq,
+			semconv.MessagingOperationPublish,
+			semconv.MessagingDestinationName(destination),
+			semconv.MessagingRabbitmqDestinationRoutingKey(key),
+			semconv.MessagingMessageID(message.MessageId),
+		))
+	defer span.End()
+
+	headers := amqp.Table{}
+	for name, value := range message.Headers {
+		headers[name] = value
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+	message.Headers = headers
+
+	err := confirm(ctx, channel, exchange, key, message)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func confirm(ctx context.Context, channel *amqp.Channel, exchange, key string, message amqp.Publishing) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	confirmation, err := channel.PublishWithDeferredConfirmWithContext(ctx, exchange, key, true, false, message)
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errNacked
+	}
+	return nil
+}
+
+// spoolReturns puts every message the broker returned as unroutable into spool. It runs until the channel closes.
+func spoolReturns(channel *amqp.Channel, spool *Spool) {
+	returns := channel.NotifyReturn(make(chan amqp.Return, 16))
+	go func() {
+		for returned := range returns {
+			log.Printf("amqp message %s returned: %d %s", returned.MessageId, returned.ReplyCode, returned.ReplyText)
+
+			err := spool.Add(spooledMessage{
+				Exchange:   returned.Exchange,
+				RoutingKey: returned.RoutingKey,
+				Publishing: amqp.Publishing{
+					Headers:       returned.Headers,
+					ContentType:   returned.ContentType,
+					DeliveryMode:  returned.DeliveryMode,
+					MessageId:     returned.MessageId,
+					CorrelationId: returned.CorrelationId,
+					Timestamp:     returned.Timestamp,
+					Type:          returned.Type,
+					Body:          returned.Body,
+				},
+			})
+			if err != nil {
+				log.Printf("spool error: %v, message %s is lost", err, returned.MessageId)
+			}
+		}
+	}()
+}
+
+// replaySpool publishes the spooled messages on channel.
+func replaySpool(channel *amqp.Channel, spool *Spool) {
+	replayed, err := spool.Replay(func(message spooledMessage) error {
+		return publishConfirmed(context.Background(), channel, message.Exchange, message.RoutingKey,
+			message.Publishing)
+	})
+	if replayed != 0 {
+		log.Printf("replayed %d spooled messages from %s", replayed, spool.Dir)
+	}
+	if err != nil {
+		log.Printf("spool replay error: %v", err)
+	}
+}
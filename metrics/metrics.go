@@ -0,0 +1,189 @@
+package metrics
+
+import (
+	"context"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"log"
+	"strconv"
+	"time"
+)
+
+var requests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_requests_total",
+	Help: "Handled HTTP requests.",
+}, []string{"route", "method", "status"})
+
+var requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "http_request_duration_seconds",
+	Help:    "Time spent handling HTTP requests.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"route", "method", "status"})
+
+var dynamoDBDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "dynamodb_request_duration_seconds",
+	Help:    "Time spent in DynamoDB calls, retries included.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"operation"})
+
+var dynamoDBErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "dynamodb_errors_total",
+	Help: "DynamoDB calls that returned an error, failed conditions included.",
+}, []string{"operation"})
+
+var published = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "messaging_published_total",
+	Help: "Published log records and events.",
+}, []string{"target", "result"})
+
+var dropped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "messaging_dropped_total",
+	Help: "Log records lost because neither the broker nor the spool took them.",
+})
+
+var outboxBacklog = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "outbox_backlog",
+	Help: "Events waiting in the outbox.",
+})
+
+var auditErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "audit_errors_total",
+	Help: "Audit entries that could not be written after the request was handled.",
+}, []string{"action"})
+
+var transactionsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "transaction_api_request_duration_seconds",
+	Help:    "Time spent fetching transactions from the transaction API.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"result"})
+
+var openAccounts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "accounts_open",
+	Help: "Open accounts per account type.",
+}, []string{"type"})
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// Middleware records the count and latency of every request. Requests that match no route share the 'unmatched'
+// route, so unknown paths can't blow up the number of series.
+func Middleware(context *gin.Context) {
+	start := time.Now()
+	context.Next()
+
+	route := context.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	status := strconv.Itoa(context.Writer.Status())
+
+	requests.WithLabelValues(route, context.Request.Method, status).Inc()
+	requestDuration.WithLabelValues(route, context.Request.Method, status).Observe(time.Since(start).Seconds())
+}
+
+// DynamoDB instruments every call of a DynamoDB client, e.g. dynamodb.NewFromConfig(cfg, metrics.DynamoDB).
+func DynamoDB(options *dynamodb.Options) {
+	options.APIOptions = append(options.APIOptions, func(stack *middleware.Stack) error {
+		// After the service metadata, so the operation name is known.
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("Metrics",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+				middleware.InitializeOutput, middleware.Metadata, error) {
+
+				start := time.Now()
+				out, metadata, err := next.HandleInitialize(ctx, in)
+
+				operation := awsmiddleware.GetOperationName(ctx)
+				dynamoDBDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+				if err != nil {
+					dynamoDBErrors.WithLabelValues(operation).Inc()
+				}
+				return out, metadata, err
+			}), middleware.After)
+	})
+}
+
+// ObservePublish counts a publish to target, 'logs' or 'events'.
+func ObservePublish(target string, err error) {
+	published.WithLabelValues(target, result(err)).Inc()
+}
+
+// ObserveDropped counts a log record that was lost.
+func ObserveDropped() {
+	dropped.Inc()
+}
+
+// ObserveAuditError counts an audit entry for action that was lost.
+func ObserveAuditError(action string) {
+	auditErrors.WithLabelValues(action).Inc()
+}
+
+// ObserveTransactions records a call to the transaction API that started at start.
+func ObserveTransactions(start time.Time, err error) {
+	transactionsDuration.WithLabelValues(result(err)).Observe(time.Since(start).Seconds())
+}
+
+// accountStatsInterval is how often the open accounts are counted.
+const accountStatsInterval = time.Minute
+
+// AccountStats keeps the open accounts gauge up to date.
+type AccountStats struct {
+	Store interface {
+		CountOpenAccounts(ctx context.Context) (map[string]int64, error)
+	}
+}
+
+// Run refreshes the gauge until ctx is done.
+func (receiver AccountStats) Run(ctx context.Context) {
+	for {
+		if counts, err := receiver.Store.CountOpenAccounts(ctx); err != nil {
+			log.Printf("CountOpenAccounts error: %v", err)
+		} else {
+			openAccounts.Reset()
+			for t, count := range counts {
+				openAccounts.WithLabelValues(t).Set(float64(count))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(accountStatsInterval):
+		}
+	}
+}
+
+// outboxStatsInterval is how often the outbox backlog is counted.
+const outboxStatsInterval = 15 * time.Second
+
+// OutboxStats keeps the outbox backlog gauge up to date. It runs whether or not events are published, so a backlog
+// that grows because the broker is missing shows up too.
+type OutboxStats struct {
+	Outbox interface {
+		CountPendingEvents(ctx context.Context) (int64, error)
+	}
+}
+
+// Run refreshes the gauge until ctx is done.
+func (receiver OutboxStats) Run(ctx context.Context) {
+	for {
+		if count, err := receiver.Outbox.CountPendingEvents(ctx); err != nil {
+			log.Printf("CountPendingEvents error: %v", err)
+		} else {
+			outboxBacklog.Set(float64(count))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(outboxStatsInterval):
+		}
+	}
+}
@@ -26,7 +26,7 @@ type Account struct {
 	// Account UUID
 	SK string `dynamodbav:"SK" json:"accountID" example:"09130407-1f81-4ac5-be85-6557683462d0"`
 	// Account amount
-	Amount float64 `dynamodbav:"Amount" json:"amount" example:"50.5"`
+	Amount Money `dynamodbav:"Amount" json:"amount" example:"50.5" swaggertype:"number"`
 	// Account limit
 	Limit int `dynamodbav:"Limit" json:"limit" example:"50"`
 	// The opening date for the account
@@ -35,6 +35,12 @@ type Account struct {
 	CloseDate *time.Time `dynamodbav:"CloseDate,omitempty" json:"closeDate,omitempty" example:"2022-12-21T14:40:20+01:00"`
 	// Account type. One of the following: 'checking', 'saving'
 	Type string `dynamodbav:"Type" json:"type" example:"checking" enums:"checking,saving"`
+	// Set by an admin. A frozen account can't be used for deposits, withdrawals or transfers, nor closed or deleted
+	Frozen bool `dynamodbav:"Frozen,omitempty" json:"frozen,omitempty" example:"false"`
+	// Account version, incremented on every change. Returned as the ETag header
+	Version int64 `dynamodbav:"Version" json:"version" example:"3"`
+	// Set when the request carries an If-Match header, so Version is checked even when it's 0. Not stored
+	CheckVersion bool `dynamodbav:"-" json:"-" swaggerignore:"true"`
 	// Account transactions
 	Transactions []Transaction `dynamodbav:"Transactions,omitempty" json:"transactions,omitempty"`
 } //@name Account
@@ -0,0 +1,193 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"hash"
+	"strconv"
+	"time"
+)
+
+const (
+	AuditViewAccounts = "view-accounts"
+	AuditViewAccount  = "view-account"
+	AuditFreeze       = "freeze"
+	AuditUnfreeze     = "unfreeze"
+	AuditSetLimit     = "set-limit"
+	AuditForceClose   = "force-close"
+	AuditCreate       = "create"
+	AuditDeposit      = "deposit"
+	AuditWithdraw     = "withdraw"
+	AuditClose        = "close"
+	AuditDelete       = "delete"
+	AuditTransfer     = "transfer"
+)
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// auditSequenceFormat is fixed width, so audit sort keys sort in chain order.
+const auditSequenceFormat = "%020d"
+
+// AuditEntry records who did what to which account, and why. The entries of an account form a hash chain: every
+// entry holds the hash of the entry before it, so changing or removing an entry breaks the chain.
+type AuditEntry struct {
+	// User UUID
+	PK string `dynamodbav:"PK" json:"-"`
+	// Audit sort key: AUDIT#<account>#<sequence>
+	SK string `dynamodbav:"SK" json:"-"`
+	// Position in the chain of the account, starting at 1
+	Sequence int64 `dynamodbav:"Sequence" json:"sequence" example:"1"`
+	// Entry UUID
+	ID string `dynamodbav:"ID" json:"id" example:"5f0f2b8e-8a55-4a8b-9d1b-3c4c8a1f9e21"`
+	// User UUID
+	UserID string `dynamodbav:"UserID" json:"userID" example:"6204037c-30e6-408b-8aaa-dd8219860b4b"`
+	// Account UUID, empty for actions on all accounts of the user
+	AccountID string `dynamodbav:"AccountID,omitempty" json:"accountID,omitempty" example:"09130407-1f81-4ac5-be85-6557683462d0"`
+	// One of the following: 'create', 'deposit', 'withdraw', 'close', 'delete', 'transfer', or for admins
+	// 'view-accounts', 'view-account', 'freeze', 'unfreeze', 'set-limit', 'force-close'
+	Action string `dynamodbav:"Action" json:"action" example:"freeze"`
+	// Subject of the token
+	Actor string `dynamodbav:"Actor" json:"actor" example:"2b1c7a0e-3d4f-4e5a-8b6c-7d8e9f0a1b2c"`
+	// IP address of the caller
+	IP string `dynamodbav:"IP,omitempty" json:"ip,omitempty" example:"203.0.113.7"`
+	// Why the action was taken, required for admin actions
+	Reason string `dynamodbav:"Reason,omitempty" json:"reason,omitempty" example:"suspected fraud, ticket 4711"`
+	// Correlation ID of the request
+	CorrelationID string `dynamodbav:"CorrelationID,omitempty" json:"correlationID,omitempty"`
+	// Either 'success' or 'failure'
+	Outcome string `dynamodbav:"Outcome" json:"outcome" example:"success" enums:"success,failure"`
+	// HTTP status of the response
+	Status int `dynamodbav:"Status,omitempty" json:"status,omitempty" example:"200"`
+	// Why the action failed
+	Error string `dynamodbav:"Error,omitempty" json:"error,omitempty" example:"account is frozen"`
+	// The account before and after a change
+	Before *Account `dynamodbav:"Before,omitempty" json:"before,omitempty"`
+	After  *Account `dynamodbav:"After,omitempty" json:"after,omitempty"`
+	// Entry date
+	Date time.Time `dynamodbav:"Date" json:"date" example:"2022-12-21T08:45:12Z"`
+	// Hash of the previous entry of the account, empty for the first one
+	PrevHash string `dynamodbav:"PrevHash,omitempty" json:"prevHash,omitempty"`
+	// HMAC-SHA256 of this entry, including PrevHash
+	Hash string `dynamodbav:"Hash" json:"hash,omitempty"`
+} //@name AuditEntry
+
+// NewAuditEntry returns the entry for action on an account of user, or on all of them when accountID is empty. The
+// entry is successful until Outcome is changed, and is added to its chain by Chain.
+func NewAuditEntry(userID, accountID, action, actor, reason string) AuditEntry {
+	return AuditEntry{
+		PK:        "USER#" + getUserID(userID),
+		ID:        uuid.NewString(),
+		UserID:    getUserID(userID),
+		AccountID: getAccountID(accountID),
+		Action:    action,
+		Actor:     actor,
+		Reason:    reason,
+		Outcome:   AuditSuccess,
+		// Postgres keeps microseconds, so drop the rest to get the same hash back.
+		Date: time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+// AuditPrefix is the start of the sort keys of the chain of an account.
+func AuditPrefix(accountID string) string {
+	return "AUDIT#" + getAccountID(accountID) + "#"
+}
+
+// Chain returns the entry appended to the chain whose last entry is prev, or as the first entry if prev is nil. The
+// hash is keyed with key.
+func (receiver AuditEntry) Chain(prev *AuditEntry, key []byte) AuditEntry {
+	receiver.Sequence = 1
+	receiver.PrevHash = ""
+	if prev != nil {
+		receiver.Sequence = prev.Sequence + 1
+		receiver.PrevHash = prev.Hash
+	}
+
+	receiver.SK = AuditPrefix(receiver.AccountID) + fmt.Sprintf(auditSequenceFormat, receiver.Sequence)
+	receiver.Hash = receiver.ComputeHash(key)
+	return receiver
+}
+
+// auditHash writes the fields of an entry length-prefixed, so no two different entries have the same encoding.
+type auditHash struct {
+	hash.Hash
+}
+
+func (receiver auditHash) field(value string) {
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(value)))
+	receiver.Write(length[:])
+	receiver.Write([]byte(value))
+}
+
+// time writes t in UTC, so the hash doesn't depend on the time zone of the backend that returned the entry.
+func (receiver auditHash) time(t time.Time) {
+	receiver.field(t.UTC().Format(time.RFC3339Nano))
+}
+
+func (receiver auditHash) account(account *Account) {
+	if account == nil {
+		receiver.field("")
+		return
+	}
+
+	receiver.field("account")
+	receiver.field(getUserID(account.PK))
+	receiver.field(getAccountID(account.SK))
+	receiver.field(strconv.FormatInt(int64(account.Amount), 10))
+	receiver.field(strconv.Itoa(account.Limit))
+	receiver.time(account.OpenDate)
+	if account.CloseDate != nil {
+		receiver.time(*account.CloseDate)
+	} else {
+		receiver.field("")
+	}
+	receiver.field(account.Type)
+	receiver.field(strconv.FormatBool(account.Frozen))
+	receiver.field(strconv.FormatInt(account.Version, 10))
+}
+
+// ComputeHash returns the HMAC-SHA256 with key of every field of the entry but Hash, in a fixed order.
+func (receiver AuditEntry) ComputeHash(key []byte) string {
+	h := auditHash{hmac.New(sha256.New, key)}
+	h.field(strconv.FormatInt(receiver.Sequence, 10))
+	h.field(receiver.ID)
+	h.field(receiver.UserID)
+	h.field(receiver.AccountID)
+	h.field(receiver.Action)
+	h.field(receiver.Actor)
+	h.field(receiver.IP)
+	h.field(receiver.Reason)
+	h.field(receiver.CorrelationID)
+	h.field(receiver.Outcome)
+	h.field(strconv.Itoa(receiver.Status))
+	h.field(receiver.Error)
+	h.account(receiver.Before)
+	h.account(receiver.After)
+	h.time(receiver.Date)
+	h.field(receiver.PrevHash)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// VerifyAuditChain checks that entries, the chain of one account ordered by sequence, are unchanged and complete, with
+// the key the hashes were computed with. It returns the sequence of the first entry that breaks the chain, or 0 if
+// there is none. Removing the newest entries can't be detected from the chain alone.
+func VerifyAuditChain(entries []AuditEntry, key []byte) int64 {
+	prevHash := ""
+	for i, entry := range entries {
+		sequence := int64(i + 1)
+		if entry.Sequence != sequence || entry.PrevHash != prevHash ||
+			!hmac.Equal([]byte(entry.Hash), []byte(entry.ComputeHash(key))) {
+			return sequence
+		}
+		prevHash = entry.Hash
+	}
+	return 0
+}
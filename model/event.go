@@ -0,0 +1,97 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// EventSchemaVersion is raised on every incompatible change of the Event payload.
+const EventSchemaVersion = 1
+
+const (
+	AccountOpened    = "AccountOpened"
+	AccountDeposited = "AccountDeposited"
+	AccountWithdrawn = "AccountWithdrawn"
+	AccountClosed    = "AccountClosed"
+	AccountDeleted   = "AccountDeleted"
+)
+
+var eventRoutingKeys = map[string]string{
+	AccountOpened:    "account.opened",
+	AccountDeposited: "account.deposited",
+	AccountWithdrawn: "account.withdrawn",
+	AccountClosed:    "account.closed",
+	AccountDeleted:   "account.deleted",
+}
+
+// Event is a domain event that is published after an account has changed.
+type Event struct {
+	// Event UUID, the same for every delivery of the event
+	ID string `dynamodbav:"ID" json:"id"`
+	// Event type, e.g. 'AccountOpened'
+	Type string `dynamodbav:"Type" json:"type"`
+	// Payload schema version
+	SchemaVersion int `dynamodbav:"SchemaVersion" json:"schemaVersion"`
+	// When the change happened
+	OccurredAt time.Time `dynamodbav:"OccurredAt" json:"occurredAt"`
+	// User UUID
+	UserID string `dynamodbav:"UserID" json:"userID"`
+	// Account UUID
+	AccountID string `dynamodbav:"AccountID" json:"accountID"`
+	// Account type, only for AccountOpened
+	AccountType string `dynamodbav:"AccountType,omitempty" json:"accountType,omitempty"`
+	// Moved amount, only for deposits and withdrawals
+	Amount Money `dynamodbav:"Amount,omitempty" json:"amount,omitempty"`
+	// The other account, when the money was moved by a transfer
+	CounterpartyID string `dynamodbav:"CounterpartyID,omitempty" json:"counterpartyID,omitempty"`
+	// Correlation ID of the request that caused the change
+	CorrelationID string `dynamodbav:"CorrelationID,omitempty" json:"correlationID,omitempty"`
+}
+
+func newEvent(eventType string, account Account) Event {
+	return Event{
+		ID:            uuid.NewString(),
+		Type:          eventType,
+		SchemaVersion: EventSchemaVersion,
+		OccurredAt:    time.Now().UTC(),
+		UserID:        getUserID(account.PK),
+		AccountID:     getAccountID(account.SK),
+	}
+}
+
+// RoutingKey returns the topic routing key of the event, e.g. 'account.opened'.
+func (event Event) RoutingKey() string {
+	return eventRoutingKeys[event.Type]
+}
+
+func NewAccountOpened(account Account) Event {
+	event := newEvent(AccountOpened, account)
+	event.AccountType = account.Type
+	return event
+}
+
+// NewAccountDeposited returns the event for money added to account. Counterparty is the sender of a transfer and
+// empty otherwise.
+func NewAccountDeposited(account Account, amount Money, counterparty string) Event {
+	event := newEvent(AccountDeposited, account)
+	event.Amount = amount
+	event.CounterpartyID = getAccountID(counterparty)
+	return event
+}
+
+// NewAccountWithdrawn returns the event for money taken from account. Counterparty is the recipient of a transfer
+// and empty otherwise.
+func NewAccountWithdrawn(account Account, amount Money, counterparty string) Event {
+	event := newEvent(AccountWithdrawn, account)
+	event.Amount = amount
+	event.CounterpartyID = getAccountID(counterparty)
+	return event
+}
+
+func NewAccountClosed(account Account) Event {
+	return newEvent(AccountClosed, account)
+}
+
+func NewAccountDeleted(account Account) Event {
+	return newEvent(AccountDeleted, account)
+}
@@ -0,0 +1,22 @@
+package model
+
+// IdempotencyRecord is the stored outcome of a request sent with an Idempotency-Key header.
+type IdempotencyRecord struct {
+	// User UUID
+	PK string `dynamodbav:"PK"`
+	// IDEMPOTENCY#<key>
+	SK string `dynamodbav:"SK"`
+	// Hash of the method, path, query, token subject and body of the first request
+	Fingerprint string `dynamodbav:"Fingerprint"`
+	// Response status code, 0 while the first request is still in progress
+	Status int `dynamodbav:"Status"`
+	// Response content type
+	ContentType string `dynamodbav:"ContentType,omitempty"`
+	// Response body
+	Body []byte `dynamodbav:"Body,omitempty"`
+	// Response headers that are replayed, such as ETag and Location
+	Headers map[string]string `dynamodbav:"Headers,omitempty"`
+	// Expiration as a Unix timestamp, used as the DynamoDB TTL attribute. While the first request is in progress, it
+	// is the end of its lease
+	ExpiresAt int64 `dynamodbav:"ExpiresAt"`
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	LedgerDeposit     = "deposit"
+	LedgerWithdrawal  = "withdrawal"
+	LedgerTransferIn  = "transfer-in"
+	LedgerTransferOut = "transfer-out"
+)
+
+// ledgerTimeFormat is fixed width, so ledger sort keys sort in time order.
+const ledgerTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+type LedgerEntry struct {
+	// User UUID
+	PK string `dynamodbav:"PK" json:"-"`
+	// Ledger sort key: LEDGER#<account>#<timestamp>
+	SK string `dynamodbav:"SK" json:"-"`
+	// Entry UUID
+	ID string `dynamodbav:"ID" json:"id" example:"0b8c5ac4-5c2e-4d7c-9d61-0c2f0a2e5a43"`
+	// Account UUID
+	AccountID string `dynamodbav:"AccountID" json:"accountID" example:"09130407-1f81-4ac5-be85-6557683462d0"`
+	// Entry type. One of the following: 'deposit', 'withdrawal', 'transfer-in', 'transfer-out'
+	Type string `dynamodbav:"Type" json:"type" example:"deposit" enums:"deposit,withdrawal,transfer-in,transfer-out"`
+	// Signed amount: positive for credits, negative for debits
+	Amount Money `dynamodbav:"Amount" json:"amount" example:"45.12" swaggertype:"number"`
+	// The other account of a transfer
+	CounterpartyID string `dynamodbav:"CounterpartyID,omitempty" json:"counterpartyID,omitempty" example:"8cca0453-8e84-4f3b-aa40-7fc9cd162a34"`
+	// Entry date
+	Date time.Time `dynamodbav:"Date" json:"date" example:"2022-12-21T08:45:12Z"`
+} //@name LedgerEntry
+
+// NewLedgerEntry returns an entry for a balance movement on account. Amount must already carry the sign.
+func NewLedgerEntry(account Account, entryType string, amount Money, counterparty string) LedgerEntry {
+	now := time.Now().UTC()
+	accountID := getAccountID(account.SK)
+
+	return LedgerEntry{
+		PK:             "USER#" + getUserID(account.PK),
+		SK:             "LEDGER#" + accountID + "#" + now.Format(ledgerTimeFormat),
+		ID:             uuid.NewString(),
+		AccountID:      accountID,
+		Type:           entryType,
+		Amount:         amount,
+		CounterpartyID: getAccountID(counterparty),
+		Date:           now,
+	}
+}
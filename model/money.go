@@ -0,0 +1,141 @@
+package model
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const moneyScale = 100
+
+var InvalidMoney = errors.New("invalid amount, at most two decimal places are allowed")
+
+// Money is an exact monetary amount stored in minor units (cents). It is written to JSON and DynamoDB as a
+// plain decimal number, so the wire format is the same as for the float64 amounts used before.
+type Money int64
+
+// NewMoney returns Money for a whole number of units.
+func NewMoney(units int64) Money {
+	return Money(units * moneyScale)
+}
+
+// ParseMoney parses a decimal number with at most two decimal places.
+func ParseMoney(value string) (Money, error) {
+	return parseMoney(value, false)
+}
+
+// parseMoney parses a decimal number. If round is set, extra decimal places are rounded half away from zero
+// instead of rejected, which is what legacy float64 balances need.
+func parseMoney(value string, round bool) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return 0, fmt.Errorf("invalid amount: %q", value)
+	}
+	r.Mul(r, big.NewRat(moneyScale, 1))
+
+	q, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Sign() != 0 {
+		if !round {
+			return 0, InvalidMoney
+		}
+		if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+			q.Add(q, big.NewInt(int64(r.Sign())))
+		}
+	}
+
+	if !q.IsInt64() {
+		return 0, fmt.Errorf("amount out of range: %q", value)
+	}
+	return Money(q.Int64()), nil
+}
+
+func (m Money) String() string {
+	v := int64(m)
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+
+	units, cents := v/moneyScale, v%moneyScale
+	if cents == 0 {
+		return sign + strconv.FormatInt(units, 10)
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%s%d.%02d", sign, units, cents), "0")
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	value, err := ParseMoney(string(bytes.Trim(data, `"`)))
+	if err != nil {
+		return err
+	}
+	*m = value
+	return nil
+}
+
+func (m Money) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	return &types.AttributeValueMemberN{Value: m.String()}, nil
+}
+
+func (m *Money) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	n, ok := av.(*types.AttributeValueMemberN)
+	if !ok {
+		return fmt.Errorf("unexpected attribute type %T for amount", av)
+	}
+
+	// Items written before the switch to Money can carry float64 noise, e.g. 100.00000000000001.
+	value, err := parseMoney(n.Value, true)
+	if err != nil {
+		return err
+	}
+	*m = value
+	return nil
+}
+
+// NormalizeMoney parses a stored amount and reports whether it is already in the canonical Money format.
+func NormalizeMoney(value string) (Money, bool, error) {
+	m, err := parseMoney(value, true)
+	if err != nil {
+		return 0, false, err
+	}
+	return m, m.String() == value, nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func (m *Money) Scan(src any) error {
+	var value Money
+	var err error
+
+	switch v := src.(type) {
+	case []byte:
+		value, err = parseMoney(string(v), true)
+	case string:
+		value, err = parseMoney(v, true)
+	case int64:
+		value = NewMoney(v)
+	default:
+		return fmt.Errorf("unexpected type %T for amount", src)
+	}
+
+	if err != nil {
+		return err
+	}
+	*m = value
+	return nil
+}
@@ -12,7 +12,7 @@ type Transaction struct {
 	// Recipient account UUID
 	RecipientID string `json:"recipientID" example:"8cca0453-8e84-4f3b-aa40-7fc9cd162a34"`
 	// Transaction amount
-	Amount float64 `json:"amount" example:"17.24"`
+	Amount Money `json:"amount" example:"17.24" swaggertype:"number"`
 	// Transaction date
 	Date time.Time `json:"date" example:"2022-12-21T08:45:12+01:00"`
 	// Transaction type
@@ -1,5 +1,7 @@
 package request
 
+import "main/model"
+
 // AccountRequest godoc
 // @Description AccountRequest with account type
 type AccountRequest struct {
@@ -11,5 +13,18 @@ type AccountRequest struct {
 // @Description	MonetaryRequest with amount to deposit
 type MonetaryRequest struct {
 	// Amount to deposit or withdraw
-	Amount float64 `json:"amount" binding:"required" example:"45.12" minimum:"1" validate:"required"`
+	Amount model.Money `json:"amount" binding:"required" example:"45.12" minimum:"1" validate:"required" swaggertype:"number"`
 } //@Name MonetaryRequest
+
+// TransferRequest godoc
+// @Description	TransferRequest with sender and recipient accounts
+type TransferRequest struct {
+	// Sender account UUID
+	SenderID string `json:"senderID" binding:"required" example:"5d84ca00-c079-4577-9560-e1014086affe"`
+	// Recipient account UUID
+	RecipientID string `json:"recipientID" binding:"required" example:"8cca0453-8e84-4f3b-aa40-7fc9cd162a34"`
+	// Recipient user UUID. If omitted, the recipient account must belong to the sender
+	RecipientUserID string `json:"recipientUserID,omitempty" example:"6204037c-30e6-408b-8aaa-dd8219860b4b"`
+	// Amount to transfer
+	Amount model.Money `json:"amount" binding:"required" example:"45.12" minimum:"1" validate:"required" swaggertype:"number"`
+} //@Name TransferRequest
@@ -0,0 +1,17 @@
+package request
+
+// AdminRequest godoc
+// @Description	AdminRequest with the reason for an admin action
+type AdminRequest struct {
+	// Why the action is taken, recorded in the audit log
+	Reason string `json:"reason" binding:"required" example:"suspected fraud, ticket 4711"`
+} //@Name AdminRequest
+
+// LimitRequest godoc
+// @Description	LimitRequest with the new overdraft limit of an account
+type LimitRequest struct {
+	// New overdraft limit
+	Limit *int `json:"limit" binding:"required,min=0" example:"500" minimum:"0"`
+	// Why the limit is changed, recorded in the audit log
+	Reason string `json:"reason" binding:"required" example:"limit raised after credit check, ticket 4712"`
+} //@Name LimitRequest
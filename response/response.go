@@ -4,3 +4,37 @@ type ErrorResponse struct {
 	// Error description.
 	Error string `json:"error" example:"invalid account id"`
 } //@name ErrorResponse
+
+type HealthResponse struct {
+	// 'ok', or 'degraded' when a connection is down.
+	Status string `json:"status" example:"ok"`
+	// State of each broker connection: 'connected' or 'disconnected'.
+	Connections map[string]string `json:"connections,omitempty"`
+} //@name HealthResponse
+
+type CheckResult struct {
+	// 'ok', 'failed', or 'degraded' for a connection that is down but doesn't fail the check.
+	Status string `json:"status" example:"ok"`
+	// How long the check took.
+	LatencyMs float64 `json:"latencyMs" example:"3.2"`
+	// Why the check failed.
+	Error string `json:"error,omitempty"`
+} //@name CheckResult
+
+type ReadinessResponse struct {
+	// 'ok', 'failed' when a check failed, or 'shutting down'.
+	Status string `json:"status" example:"ok"`
+	// Result of each dependency check.
+	Checks map[string]CheckResult `json:"checks"`
+} //@name ReadinessResponse
+
+type AuditVerification struct {
+	// Whether every entry of the chain is unchanged and in place.
+	Valid bool `json:"valid" example:"true"`
+	// Number of entries in the chain.
+	Entries int `json:"entries" example:"12"`
+	// Sequence of the first entry that breaks the chain.
+	BrokenAt int64 `json:"brokenAt,omitempty" example:"7"`
+	// Hash of the last entry. Keep it elsewhere to also detect removed entries at the end of the chain.
+	LastHash string `json:"lastHash,omitempty" example:"9f2c8e0c4b1a6d3e5f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e"`
+} //@name AuditVerification
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strings"
+)
+
+// ServiceName is the default service.name of the spans. OTEL_SERVICE_NAME overrides it.
+const ServiceName = "account-service"
+
+// Init installs the global tracer provider and the W3C trace context propagator. name selects the exporter: 'otlp',
+// configured by the standard OTEL_EXPORTER_OTLP_* variables, 'stdout' or 'none'. The returned function flushes the
+// remaining spans.
+func Init(ctx context.Context, name string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{},
+		propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch name {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	default:
+		err = fmt.Errorf("unsupported OTEL_TRACES_EXPORTER: %s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Middleware traces every request except the metrics, health, readiness and debug endpoints.
+func Middleware() gin.HandlerFunc {
+	return otelgin.Middleware(ServiceName, otelgin.WithFilter(func(request *http.Request) bool {
+		path := request.URL.Path
+		return path != "/metrics" && !strings.HasPrefix(path, "/health") && path != "/readyz" &&
+			!strings.HasPrefix(path, "/debug/")
+	}))
+}
+
+// DynamoDB adds a client span for every call of a DynamoDB client, e.g.
+// dynamodb.NewFromConfig(cfg, tracing.DynamoDB).
+func DynamoDB(options *dynamodb.Options) {
+	options.APIOptions = append(options.APIOptions, func(stack *middleware.Stack) error {
+		// After the service metadata, so the operation name is known.
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("Tracing",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+				middleware.InitializeOutput, middleware.Metadata, error) {
+
+				operation := awsmiddleware.GetOperationName(ctx)
+				ctx, span := otel.Tracer("main/db").Start(ctx, "DynamoDB."+operation,
+					trace.WithSpanKind(trace.SpanKindClient),
+					trace.WithAttributes(
+						semconv.RPCSystemKey.String("aws-api"),
+						semconv.RPCService("DynamoDB"),
+						semconv.RPCMethod(operation),
+					))
+				defer span.End()
+
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				if err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+				}
+				return out, metadata, err
+			}), middleware.After)
+	})
+}
@@ -0,0 +1,80 @@
+package util
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"main/response"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	ScopeAccountsRead   = "accounts:read"
+	ScopeAccountsWrite  = "accounts:write"
+	ScopeAccountsClose  = "accounts:close"
+	ScopeAccountsDelete = "accounts:delete"
+)
+
+// AdminRole lets a token act on the accounts of other users through the userID query parameter.
+const AdminRole = "admin"
+
+// AccountScopes are all the scopes of the account endpoints.
+var AccountScopes = []string{ScopeAccountsRead, ScopeAccountsWrite, ScopeAccountsClose, ScopeAccountsDelete}
+
+// Has reports whether the token grants permission, either as one of the space separated scopes or as a role.
+func (receiver Claims) Has(permission string) bool {
+	return slices.Contains(strings.Fields(receiver.Scope), permission) || slices.Contains(receiver.Roles, permission)
+}
+
+func (receiver Claims) IsAdmin() bool {
+	return slices.Contains(receiver.Roles, AdminRole)
+}
+
+func forbidden(context *gin.Context, err error) {
+	_ = context.Error(err)
+	context.AbortWithStatusJSON(http.StatusForbidden, response.ErrorResponse{Error: err.Error()})
+}
+
+// RequireScope lets a request through only if its token grants scope. It must run after ValidateToken. With a
+// userID query parameter, an admin acts on the accounts of that user: the handlers see it as the ID, while Subject
+// stays the caller.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		claims := context.MustGet("Claims").(Claims)
+		if !claims.Has(scope) {
+			forbidden(context, errors.New("token is missing the "+scope+" scope"))
+			return
+		}
+
+		userID := context.Query("userID")
+		if userID == "" || userID == claims.Subject {
+			context.Next()
+			return
+		}
+
+		if !claims.IsAdmin() {
+			forbidden(context, errors.New("only admins can act on the accounts of other users"))
+			return
+		}
+		if !IsValidUUID(userID) {
+			err := context.Error(errors.New("invalid user id"))
+			context.AbortWithStatusJSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		context.Set("ID", userID)
+		context.Next()
+	}
+}
+
+// RequireRole lets a request through only if its token has role. It must run after ValidateToken.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if !slices.Contains(context.MustGet("Claims").(Claims).Roles, role) {
+			forbidden(context, errors.New("token is missing the "+role+" role"))
+			return
+		}
+		context.Next()
+	}
+}
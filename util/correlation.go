@@ -0,0 +1,63 @@
+package util
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CorrelationHeader carries the correlation ID between services.
+const CorrelationHeader = "Correlation"
+
+const maxCorrelationIDLength = 128
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a copy of ctx that carries id.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or an empty string.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+func validCorrelationID(id string) bool {
+	if id == "" || len(id) > maxCorrelationIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' ||
+			c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID returns the correlation ID of the request. The Correlation header of the caller is reused when it is
+// valid, otherwise a new ID is created. The ID is stored on first use, so every later call returns the same one.
+func RequestID(context *gin.Context) string {
+	if id := context.GetString(CorrelationHeader); id != "" {
+		return id
+	}
+
+	id := context.GetHeader(CorrelationHeader)
+	if !validCorrelationID(id) {
+		id = uuid.NewString()
+	}
+
+	context.Set(CorrelationHeader, id)
+	context.Request = context.Request.WithContext(WithCorrelationID(context.Request.Context(), id))
+	return id
+}
+
+// Correlation assigns the correlation ID to the request and returns it in the Correlation response header. It must
+// run before every other middleware, so logs, events and downstream calls all share the same ID.
+func Correlation(context *gin.Context) {
+	context.Header(CorrelationHeader, RequestID(context))
+	context.Next()
+}
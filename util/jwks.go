@@ -0,0 +1,248 @@
+package util
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minJWKSRefresh limits how often a token with an unknown kid can make JWKS fetch the document again.
+const minJWKSRefresh = 30 * time.Second
+
+var UnknownKey = errors.New("unknown signing key")
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type verificationKey struct {
+	alg string
+	key interface{}
+}
+
+// JWKS holds the public keys of a JSON Web Key Set by kid. Source is an http(s) URL or a file path. The document is
+// loaded again every RefreshInterval and whenever a token names a kid that is not known yet, so keys can be rotated
+// without a restart.
+type JWKS struct {
+	Source          string
+	RefreshInterval time.Duration
+	// Timeout bounds fetching the document from a URL.
+	Timeout time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]verificationKey
+	lastRefresh time.Time
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func (receiver jwk) publicKey() (verificationKey, error) {
+	switch receiver.Kty {
+	case "RSA":
+		n, err := decodeInt(receiver.N)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		e, err := decodeInt(receiver.E)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || n.BitLen() < 2048 {
+			return verificationKey{}, errors.New("weak RSA key")
+		}
+		return verificationKey{alg: "RS256", key: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+	case "EC":
+		if receiver.Crv != "P-256" {
+			return verificationKey{}, fmt.Errorf("unsupported curve %s", receiver.Crv)
+		}
+		x, err := decodeInt(receiver.X)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		y, err := decodeInt(receiver.Y)
+		if err != nil {
+			return verificationKey{}, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return verificationKey{}, errors.New("point is not on the curve")
+		}
+		return verificationKey{alg: "ES256", key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+	}
+	return verificationKey{}, fmt.Errorf("unsupported key type %s", receiver.Kty)
+}
+
+func (receiver *JWKS) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(receiver.Source, "http://") && !strings.HasPrefix(receiver.Source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(receiver.Source, "file://"))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, receiver.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, receiver.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func(body io.ReadCloser) {
+		if err := body.Close(); err != nil {
+			log.Printf("Close error: %s\n", err)
+		}
+	}(res.Body)
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS request failed with status %d", res.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+// Refresh loads the document again. Keys that can't be used for RS256 or ES256 signatures are skipped. On error
+// the keys loaded before are kept.
+func (receiver *JWKS) Refresh(ctx context.Context) error {
+	receiver.mu.Lock()
+	receiver.lastRefresh = time.Now()
+	receiver.mu.Unlock()
+
+	data, err := receiver.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("skipping JWKS key %q: %s\n", k.Kid, err)
+			continue
+		}
+		if k.Alg != "" && k.Alg != key.alg {
+			log.Printf("skipping JWKS key %q: unsupported alg %s\n", k.Kid, k.Alg)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS has no usable keys")
+	}
+
+	receiver.mu.Lock()
+	receiver.keys = keys
+	receiver.mu.Unlock()
+	return nil
+}
+
+func (receiver *JWKS) lookup(kid string) (verificationKey, bool) {
+	receiver.mu.RLock()
+	defer receiver.mu.RUnlock()
+
+	if kid == "" && len(receiver.keys) == 1 {
+		for _, key := range receiver.keys {
+			return key, true
+		}
+	}
+	key, ok := receiver.keys[kid]
+	return key, ok
+}
+
+// refreshDue reports whether a token with an unknown kid may fetch the document again, and if so, claims the refresh,
+// so concurrent requests don't all fetch it.
+func (receiver *JWKS) refreshDue() bool {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+
+	if time.Since(receiver.lastRefresh) < minJWKSRefresh {
+		return false
+	}
+	receiver.lastRefresh = time.Now()
+	return true
+}
+
+// Key returns the public key for a token signed with alg by kid. A token without a kid is accepted when the set has
+// only one key.
+func (receiver *JWKS) Key(ctx context.Context, alg, kid string) (interface{}, error) {
+	key, ok := receiver.lookup(kid)
+	if !ok {
+		if !receiver.refreshDue() {
+			return nil, UnknownKey
+		}
+		if err := receiver.Refresh(ctx); err != nil {
+			log.Printf("JWKS refresh error: %s\n", err)
+		}
+
+		if key, ok = receiver.lookup(kid); !ok {
+			return nil, UnknownKey
+		}
+	}
+
+	if key.alg != alg {
+		return nil, fmt.Errorf("key %q is not an %s key", kid, alg)
+	}
+	return key.key, nil
+}
+
+// Connected reports whether keys have been loaded.
+func (receiver *JWKS) Connected() bool {
+	receiver.mu.RLock()
+	defer receiver.mu.RUnlock()
+
+	return len(receiver.keys) != 0
+}
+
+// Run refreshes the keys every RefreshInterval until ctx is done.
+func (receiver *JWKS) Run(ctx context.Context) {
+	ticker := time.NewTicker(receiver.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := receiver.Refresh(ctx); err != nil {
+				log.Printf("JWKS refresh error: %s\n", err)
+			}
+		}
+	}
+}
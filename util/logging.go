@@ -1,52 +1,57 @@
 package util
 
 import (
-	"fmt"
+	"encoding/json"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
-	"github.com/google/uuid"
-	"os"
+	"go.opentelemetry.io/otel/trace"
 	"strings"
 	"time"
 )
 
-func logging(level string, context *gin.Context) string {
+// LogFormatText is the legacy key=value log format. The default is JSON.
+const LogFormatText = "text"
+
+// LogMessage is a log record encoded in the configured format.
+type LogMessage struct {
+	ContentType   string
+	Body          []byte
+	CorrelationID string
+}
+
+type logRecord struct {
+	Time        time.Time `json:"time"`
+	Level       string    `json:"level"`
+	Message     string    `json:"msg,omitempty"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Status      int       `json:"status"`
+	LatencyMs   float64   `json:"latencyMs"`
+	IP          string    `json:"ip"`
+	Subject     string    `json:"subject,omitempty"`
+	Correlation string    `json:"correlation"`
+	TraceID     string    `json:"traceID,omitempty"`
+}
+
+// subject returns the subject of the token that ValidateToken accepted, or an empty string when the request was not
+// authenticated. It is the caller, even when an admin acts for another user.
+func subject(context *gin.Context) string {
+	return context.GetString("Subject")
+}
+
+func legacyLogging(level string, context *gin.Context) string {
 	var sb strings.Builder
 
 	sb.WriteString("time=" + time.Now().Format("2006-01-02 15-04-05"))
-
-	context.Set("Correlation", uuid.NewString())
-	sb.WriteString(" id=" + context.MustGet("Correlation").(string))
+	sb.WriteString(" id=" + RequestID(context))
 
 	sb.WriteString(" level=" + level)
 	sb.WriteString(" path=" + context.Request.RequestURI)
 
-	correlation := context.GetHeader("Correlation")
-	if correlation == "" {
-		correlation = "nil"
-	}
-	sb.WriteString(" correlation=" + correlation)
+	sb.WriteString(" correlation=" + RequestID(context))
 	sb.WriteString(" ip=" + context.ClientIP())
 
-	var token string
-	values := strings.Split(context.GetHeader("Authorization"), "Bearer ")
-
-	if len(values) == 2 {
-		token = values[1]
-
-		to, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
-
-		if err == nil && to.Valid {
-			if claims, ok := to.Claims.(jwt.MapClaims); ok {
-				token = claims["sub"].(string)
-			}
-		}
-	} else {
+	token := subject(context)
+	if token == "" {
 		token = "nil"
 	}
 	sb.WriteString(" auth=" + token)
@@ -54,10 +59,40 @@ func logging(level string, context *gin.Context) string {
 	return sb.String()
 }
 
-func Info(context *gin.Context) string {
-	return logging("info", context)
+func logging(format, level, msg string, context *gin.Context, latency time.Duration) LogMessage {
+	if format == LogFormatText {
+		text := legacyLogging(level, context)
+		if msg != "" {
+			text += " msg=" + msg
+		}
+		return LogMessage{ContentType: "text/plain", Body: []byte(text), CorrelationID: RequestID(context)}
+	}
+
+	record := logRecord{
+		Time:        time.Now().UTC(),
+		Level:       level,
+		Message:     msg,
+		Method:      context.Request.Method,
+		Path:        context.Request.URL.Path,
+		Status:      context.Writer.Status(),
+		LatencyMs:   float64(latency.Microseconds()) / 1000,
+		IP:          context.ClientIP(),
+		Subject:     subject(context),
+		Correlation: RequestID(context),
+	}
+	if span := trace.SpanContextFromContext(context.Request.Context()); span.HasTraceID() {
+		record.TraceID = span.TraceID().String()
+	}
+
+	body, _ := json.Marshal(record)
+	return LogMessage{ContentType: "application/json", Body: body, CorrelationID: record.Correlation}
+}
+
+// Info returns the record of a finished request in format. Latency is the time the request took.
+func Info(format string, context *gin.Context, latency time.Duration) LogMessage {
+	return logging(format, "info", "", context, latency)
 }
 
-func Error(err string, context *gin.Context) string {
-	return logging("error", context) + " msg=" + err
+func Error(format, err string, context *gin.Context, latency time.Duration) LogMessage {
+	return logging(format, "error", err, context, latency)
 }
@@ -0,0 +1,157 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"io"
+	"log"
+	"main/metrics"
+	"main/model"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Services calls the other services of the project: the transaction API and account-stat. The URLs are base URLs
+// such as http://transaction-api:8085.
+type Services struct {
+	TransactionAPI string
+	AccountStat    string
+	// Timeout bounds every call.
+	Timeout time.Duration
+}
+
+func (receiver Services) upload(endpoint, token, correlation string, payload []byte) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		log.Printf("NewRequest error: %v", err)
+		return
+	}
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add(CorrelationHeader, correlation)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := http.Client{
+		Timeout: receiver.Timeout,
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		log.Printf("Do error: %v", err)
+		return
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		log.Printf("ReadAll error: %v", err)
+		return
+	}
+	defer func(body io.ReadCloser) {
+		if err := body.Close(); err != nil {
+			log.Printf("Close error: %s\n", err)
+		}
+	}(res.Body)
+
+	if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusInternalServerError {
+		log.Printf("ReadAll error: %v", string(data))
+	}
+}
+
+func (receiver Services) UploadStat(ctx *gin.Context) {
+	payload, err := json.Marshal(map[string]string{"endpoint": ctx.FullPath()})
+	if err != nil {
+		log.Printf("Marshal error: %v", err)
+		return
+	}
+
+	receiver.upload(receiver.AccountStat+"/api/v1/stat", ctx.MustGet("token").(string), RequestID(ctx), payload)
+}
+
+func (receiver Services) UploadAccount(account model.Account, ctx *gin.Context) {
+	payload, err := json.Marshal(map[string]string{"userID": account.PK, "accountID": account.SK, "type": account.Type,
+		"openDate": time.Now().Format("2006-01-02 15:04:05")})
+	if err != nil {
+		log.Printf("Marshal error: %v", err)
+		return
+	}
+
+	receiver.upload(receiver.AccountStat+"/api/v1/account", ctx.MustGet("token").(string), RequestID(ctx), payload)
+}
+
+// GetTransactions fetches the transactions of an account from the transaction API. The call is traced as a child of
+// ctx and sends its trace context and correlation ID along.
+func (receiver Services) GetTransactions(ctx context.Context, accountID,
+	token string) (transactions []model.Transaction, err error) {
+
+	defer func(start time.Time) {
+		metrics.ObserveTransactions(start, err)
+	}(time.Now())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		receiver.TransactionAPI+"/api/v1/transaction/"+accountID+"/all", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add(CorrelationHeader, CorrelationID(ctx))
+
+	client := http.Client{
+		Timeout:   receiver.Timeout,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return []model.Transaction{}, err
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer func(body io.ReadCloser) {
+		if err := body.Close(); err != nil {
+			log.Printf("Close error: %s\n", err)
+		}
+	}(res.Body)
+
+	if res.StatusCode == http.StatusNoContent {
+		return []model.Transaction{}, nil
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("error: " + string(data))
+	}
+
+	var tr []model.Transaction
+	if err := json.Unmarshal(data, &tr); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// PingTransactionAPI checks that the transaction API accepts connections.
+func (receiver Services) PingTransactionAPI(ctx context.Context) error {
+	target, err := url.Parse(receiver.TransactionAPI)
+	if err != nil {
+		return err
+	}
+
+	address := target.Host
+	if target.Port() == "" {
+		address = net.JoinHostPort(target.Hostname(), "80")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -1,19 +1,15 @@
 package util
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"io"
-	"log"
 	"main/model"
 	"main/response"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 )
@@ -24,11 +20,15 @@ var AlreadyExists = errors.New("account with this type already exists")
 var InsufficientFounds = errors.New("insufficient funds")
 var InvalidAccount = errors.New("invalid account")
 var OpenAccount = errors.New("account is not closed")
-
-var AccountTypesLimit = map[string]int{
-	"checking": 50,
-	"saving":   10,
-}
+var ClosedAccount = errors.New("account is closed")
+var AlreadyClosed = errors.New("account is already closed")
+var InvalidCursor = errors.New("invalid cursor")
+var SameAccount = errors.New("sender and recipient must be different accounts")
+var VersionMismatch = errors.New("account version does not match If-Match")
+var FrozenAccount = errors.New("account is frozen")
+var AlreadyFrozen = errors.New("account is already frozen")
+var NotFrozen = errors.New("account is not frozen")
+var AuditConflict = errors.New("audit log was changed concurrently, try again")
 
 func IsValidUUID(u string) bool {
 	_, err := uuid.Parse(u)
@@ -49,172 +49,97 @@ func GetSK(id string) string {
 	return "ACCOUNT#" + id
 }
 
-func upload(url, token string, payload []byte) {
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(payload))
-	if err != nil {
-		log.Printf("NewRequest error: %v", err)
-		return
-	}
-	req.Header.Add("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	res, err := client.Do(req)
-	if err != nil {
-		log.Printf("Do error: %v", err)
-		return
-	}
-
-	data, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Printf("ReadAll error: %v", err)
-		return
-	}
-	defer func(body io.ReadCloser) {
-		if err := body.Close(); err != nil {
-			log.Printf("Close error: %s\n", err)
-		}
-	}(res.Body)
-
-	if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusInternalServerError {
-		log.Printf("ReadAll error: %v", string(data))
-	}
-}
-
-func UploadStat(ctx *gin.Context) {
-	payload, err := json.Marshal(map[string]string{"endpoint": ctx.FullPath()})
-	if err != nil {
-		log.Printf("Marshal error: %v", err)
-		return
-	}
-
-	upload("http://account-stat:8090/api/v1/stat", ctx.MustGet("token").(string), payload)
+// Auth validates RS256 and ES256 tokens against the keys in JWKS and, as a fallback, HMAC tokens signed with
+// Secret. Either can be left empty to not accept those tokens. Secret also signs the tokens of RandomToken.
+type Auth struct {
+	Secret []byte
+	JWKS   *JWKS
+	// Issuer and Audience must match the iss and aud claims of every token.
+	Issuer   string
+	Audience string
+	// Leeway is the clock skew allowed when checking exp, nbf and iat.
+	Leeway time.Duration
 }
 
-func UploadAccount(account model.Account, ctx *gin.Context) {
-	payload, err := json.Marshal(map[string]string{"userID": account.PK, "accountID": account.SK, "type": account.Type,
-		"openDate": time.Now().Format("2006-01-02 15:04:05")})
-	if err != nil {
-		log.Printf("Marshal error: %v", err)
-		return
-	}
-
-	upload("http://account-stat:8090/api/v1/account", ctx.MustGet("token").(string), payload)
+// Claims are the claims of an access token.
+type Claims struct {
+	jwt.RegisteredClaims
+	// Scope is a space separated list of the granted scopes.
+	Scope string   `json:"scope,omitempty"`
+	Roles []string `json:"roles,omitempty"`
 }
 
-func GetTransactions(accountID, token, correlation string) ([]model.Transaction, error) {
-	req, err := http.NewRequest(http.MethodGet, "http://transaction-api:8085/api/v1/transaction/"+accountID+"/all", nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Add("Authorization", "Bearer "+token)
-	req.Header.Add("Correlation", correlation)
-
-	client := http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	res, err := client.Do(req)
-	if err != nil {
-		return []model.Transaction{}, err
-	}
-
-	data, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
-	defer func(body io.ReadCloser) {
-		if err := body.Close(); err != nil {
-			log.Printf("Close error: %s\n", err)
+func (receiver Auth) key(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			if len(receiver.Secret) != 0 {
+				return receiver.Secret, nil
+			}
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+			alg := token.Method.Alg()
+			if receiver.JWKS != nil && (alg == "RS256" || alg == "ES256") {
+				kid, _ := token.Header["kid"].(string)
+				return receiver.JWKS.Key(ctx, alg, kid)
+			}
 		}
-	}(res.Body)
-
-	if res.StatusCode == http.StatusNoContent {
-		return []model.Transaction{}, nil
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 	}
+}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, errors.New("error: " + string(data))
-	}
+// unauthorized rejects a request that has no valid token.
+func unauthorized(context *gin.Context, err error) {
+	_ = context.Error(err)
+	context.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	context.AbortWithStatusJSON(http.StatusUnauthorized, response.ErrorResponse{Error: err.Error()})
+}
 
-	var tr []model.Transaction
-	if err := json.Unmarshal(data, &tr); err != nil {
-		return nil, err
-	}
-	return tr, nil
+func (receiver Auth) parser() *jwt.Parser {
+	return jwt.NewParser(
+		jwt.WithIssuer(receiver.Issuer),
+		jwt.WithAudience(receiver.Audience),
+		jwt.WithLeeway(receiver.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 }
 
-func ValidateToken(context *gin.Context) {
-	token := context.GetHeader("Authorization")
-	if token == "" {
-		context.JSON(http.StatusUnauthorized, response.ErrorResponse{Error: "unauthorized"})
-		context.Abort()
+// ValidateToken accepts a request with a valid bearer token: signed by a known key, issued by Issuer for Audience,
+// with a subject, iat and exp, and within its nbf and exp, give or take Leeway. Every other request gets 401.
+func (receiver Auth) ValidateToken(context *gin.Context) {
+	header := context.GetHeader("Authorization")
+	if header == "" {
+		unauthorized(context, errors.New("unauthorized"))
 		return
 	}
 
-	values := strings.Split(token, "Bearer ")
-	if len(values) != 2 {
-		context.JSON(http.StatusUnauthorized, response.ErrorResponse{Error: "token is not set properly"})
-		context.Abort()
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		unauthorized(context, errors.New("token is not set properly"))
 		return
 	}
-	token = values[1]
 
-	to, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+	var claims Claims
+	_, err := receiver.parser().ParseWithClaims(token, &claims, receiver.key(context.Request.Context()))
 	if err != nil {
-		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: err.Error()})
-		context.Abort()
+		unauthorized(context, err)
 		return
 	}
 
-	if !to.Valid {
-		context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: "invalid token"})
-		context.Abort()
+	if claims.Subject == "" {
+		unauthorized(context, errors.New("token has no sub"))
 		return
 	}
-
-	if claims, ok := to.Claims.(jwt.MapClaims); ok {
-		if claims["sub"] == "" {
-			context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: "invalid id"})
-			context.Abort()
-			return
-		}
-
-		if claims["iat"] == "" || claims["exp"] == "" {
-			context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: "iat or exp not set"})
-			context.Abort()
-			return
-		}
-
-		tokenIat := time.Unix(int64(claims["iat"].(float64)), 0)
-		if tokenIat.After(time.Now()) {
-			context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: "iat can't be in the future"})
-			context.Abort()
-			return
-		}
-
-		tokenExp := time.Unix(int64(claims["exp"].(float64)), 0)
-		if tokenExp.Before(time.Now()) {
-			context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: "expired token"})
-			context.Abort()
-			return
-		}
-
-		context.Set("ID", claims["sub"])
-		context.Set("token", token)
-		context.Next()
+	if claims.IssuedAt == nil {
+		unauthorized(context, errors.New("token has no iat"))
 		return
 	}
-	context.JSON(http.StatusBadRequest, response.ErrorResponse{Error: "invalid token"})
+
+	context.Set("ID", claims.Subject)
+	context.Set("Subject", claims.Subject)
+	context.Set("Claims", claims)
+	context.Set("token", token)
+	context.Next()
 }
 
 // RandomToken godoc
@@ -226,16 +151,26 @@ func ValidateToken(context *gin.Context) {
 //	@Success		200	{object}	[]model.Token	"Token"
 //	@Failure		500	{object}	response.ErrorResponse
 //	@Router			/login [GET]
-func RandomToken(context *gin.Context) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512,
-		jwt.MapClaims{
-			"sub": uuid.New().String(),
-			"iat": time.Now().Unix(),
-			"exp": time.Now().Add(time.Hour * 24).Unix(),
+func (receiver Auth) RandomToken(context *gin.Context) {
+	if len(receiver.Secret) == 0 {
+		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: "HMAC tokens are disabled"})
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   uuid.New().String(),
+			Issuer:    receiver.Issuer,
+			Audience:  jwt.ClaimStrings{receiver.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour * 24)),
 		},
-	)
+		Scope: strings.Join(AccountScopes, " "),
+	})
 
-	s, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	s, err := token.SignedString(receiver.Secret)
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, response.ErrorResponse{Error: err.Error()})
 		return
@@ -246,8 +181,9 @@ func RandomToken(context *gin.Context) {
 func CORS(context *gin.Context) {
 	context.Header("Access-Control-Allow-Origin", "*")
 	context.Header("Access-Control-Allow-Credentials", "true")
-	context.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, Authorization, Origin, Accept, Cache-Control")
+	context.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, Authorization, Origin, Accept, Cache-Control, Idempotency-Key, If-Match, Correlation")
 	context.Header("Access-Control-Allow-Methods", "OPTIONS, POST, GET, PATCH, DELETE")
+	context.Header("Access-Control-Expose-Headers", "X-Next-Cursor, Idempotent-Replayed, ETag, Correlation")
 	context.Header("Access-Control-Max-Age", "86400")
 
 	if context.Request.Method == http.MethodOptions {
@@ -0,0 +1,186 @@
+package util
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://auth.example.com"
+	testAudience = "account-service"
+	testSubject  = "6204037c-30e6-408b-8aaa-dd8219860b4b"
+	testLeeway   = time.Minute
+)
+
+var testSecret = []byte("test-secret")
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"sub": testSubject,
+		"iss": testIssuer,
+		"aud": testAudience,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+// withClaims returns the valid claims with the given claims changed, or removed if their value is nil.
+func withClaims(changes jwt.MapClaims) jwt.MapClaims {
+	claims := validClaims()
+	for name, value := range changes {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+	return claims
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// testJWKS returns a key set with the public key of key as kid, loaded from a file.
+func testJWKS(t *testing.T, key *ecdsa.PrivateKey, kid string) *JWKS {
+	t.Helper()
+
+	encode := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	set := map[string][]jwk{"keys": {{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   encode(key.X.FillBytes(make([]byte, 32))),
+		Y:   encode(key.Y.FillBytes(make([]byte, 32))),
+	}}}
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := &JWKS{Source: path, RefreshInterval: time.Hour, Timeout: time.Second}
+	if err := jwks.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return jwks
+}
+
+func TestValidateToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hmacAuth := Auth{Secret: testSecret, Issuer: testIssuer, Audience: testAudience, Leeway: testLeeway}
+	jwksAuth := Auth{JWKS: testJWKS(t, key, "k1"), Issuer: testIssuer, Audience: testAudience, Leeway: testLeeway}
+
+	hs512 := func(claims jwt.MapClaims) string {
+		return "Bearer " + sign(t, jwt.SigningMethodHS512, testSecret, claims)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		auth   Auth
+		header string
+		status int
+	}{
+		{"valid HMAC token", hmacAuth, hs512(validClaims()), http.StatusOK},
+		{"valid JWKS token", jwksAuth, "Bearer " + signES256(t, key, "k1", validClaims()), http.StatusOK},
+		{"no Authorization header", hmacAuth, "", http.StatusUnauthorized},
+		{"no Bearer prefix", hmacAuth, sign(t, jwt.SigningMethodHS512, testSecret, validClaims()),
+			http.StatusUnauthorized},
+		{"empty token", hmacAuth, "Bearer ", http.StatusUnauthorized},
+		{"garbage token", hmacAuth, "Bearer not.a.token", http.StatusUnauthorized},
+		{"bad signature", hmacAuth, "Bearer " + sign(t, jwt.SigningMethodHS512, []byte("other"), validClaims()),
+			http.StatusUnauthorized},
+		{"none alg", hmacAuth,
+			"Bearer " + sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims()),
+			http.StatusUnauthorized},
+		{"HS256 token with only JWKS", jwksAuth,
+			"Bearer " + sign(t, jwt.SigningMethodHS256, testSecret, validClaims()), http.StatusUnauthorized},
+		{"unknown kid", jwksAuth, "Bearer " + signES256(t, key, "k2", validClaims()), http.StatusUnauthorized},
+		{"missing sub", hmacAuth, hs512(withClaims(jwt.MapClaims{"sub": nil})), http.StatusUnauthorized},
+		{"missing iat", hmacAuth, hs512(withClaims(jwt.MapClaims{"iat": nil})), http.StatusUnauthorized},
+		{"missing exp", hmacAuth, hs512(withClaims(jwt.MapClaims{"exp": nil})), http.StatusUnauthorized},
+		{"wrong iss", hmacAuth, hs512(withClaims(jwt.MapClaims{"iss": "https://evil.example.com"})),
+			http.StatusUnauthorized},
+		{"wrong aud", hmacAuth, hs512(withClaims(jwt.MapClaims{"aud": "other-service"})), http.StatusUnauthorized},
+		{"nbf in the future", hmacAuth, hs512(withClaims(jwt.MapClaims{"nbf": now.Add(time.Hour).Unix()})),
+			http.StatusUnauthorized},
+		{"expired within leeway", hmacAuth,
+			hs512(withClaims(jwt.MapClaims{"exp": now.Add(-testLeeway / 2).Unix()})), http.StatusOK},
+		{"expired beyond leeway", hmacAuth,
+			hs512(withClaims(jwt.MapClaims{"exp": now.Add(-2 * testLeeway).Unix()})), http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", test.auth.ValidateToken, func(context *gin.Context) {
+				if context.GetString("Subject") != testSubject {
+					t.Errorf("Subject = %q, want %q", context.GetString("Subject"), testSubject)
+				}
+				context.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.header != "" {
+				req.Header.Set("Authorization", test.header)
+			}
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+
+			if res.Code != test.status {
+				t.Fatalf("status = %d, want %d: %s", res.Code, test.status, res.Body.String())
+			}
+			if test.status == http.StatusUnauthorized &&
+				res.Header().Get("WWW-Authenticate") != `Bearer error="invalid_token"` {
+				t.Errorf("WWW-Authenticate = %q", res.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}